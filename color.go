@@ -0,0 +1,66 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// NoColorName is the environment variable that, if not empty, stops colored output.
+// See https://no-color.org/
+const noColorName = "NO_COLOR"
+
+// ANSI escape sequences that color text red, yellow or green, then reset it.
+const (
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiGreen  = "\x1b[32m"
+	ansiReset  = "\x1b[0m"
+)
+
+// GetUrgency returns "red" if expires is before now plus warn, or has passed if warn == 0,
+// "yellow" if expires is within a month of now, otherwise "green".
+func getUrgency(expires, now time.Time) (urgency string) {
+	switch {
+	case expires.Before(now.Add(warn)):
+		return "red"
+	case expires.Before(now.AddDate(0, 1, 0)):
+		return "yellow"
+	}
+	return "green"
+}
+
+// IsColorTerminal returns true if file is a terminal and environment variable noColorName is empty.
+func isColorTerminal(file *os.File) bool {
+	if os.Getenv(noColorName) != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return (err == nil) && (info.Mode()&os.ModeCharDevice != 0)
+}
+
+// ColorFields returns the fields of detail, as certDetail.fields,
+// with its toExpiry field colored by ANSI escape sequences as getUrgency.
+func colorFields(detail certDetail) []string {
+	const toExpiryI = 1 // index of toExpiry in header
+	colors := map[string]string{"red": ansiRed, "yellow": ansiYellow, "green": ansiGreen}
+	fields := detail.fields()
+	fields[toExpiryI] = colors[getUrgency(detail.Expires, time.Now())] + fields[toExpiryI] + ansiReset
+	return fields
+}
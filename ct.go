@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// if checkCT == true then check whether each leaf certificate is in Certificate Transparency logs
+const ctFlag = "ct"
+const ctText = "check whether each leaf certificate is publicly logged in Certificate Transparency, " +
+	"searching the logs with -ct-search: logged, not logged or unknown"
+
+var checkCT bool
+
+// ctSearch is the crt.sh compatible search of Certificate Transparency logs to check with
+const ctSearchFlag = "ct-search"
+const ctSearchText = "with -ct, search Certificate Transparency logs at this crt.sh compatible URL"
+
+var ctSearch string
+
+// GetCTStatus searches ctSearch for the leaf certificate in certs, a chain with the leaf first,
+// by its serial number and issuer CN, which its precertificate shares, as CAs often only log that,
+// returning status == logged or not logged and err == nil.
+// A certificate not logged was likely issued by a private CA, as public CAs must log.
+// If failed to search, getCTStatus returns status == "unknown" and err != nil.
+func getCTStatus(certs []*x509.Certificate) (status string, err error) {
+	const unknown = "unknown"
+	leaf := certs[0]
+	search, err := url.Parse(ctSearch)
+	if err != nil {
+		return unknown, fmt.Errorf("CT search: %w", err)
+	}
+	query := search.Query()
+	query.Set("serial", fmt.Sprintf("%x", leaf.SerialNumber))
+	query.Set("output", "json")
+	search.RawQuery = query.Encode()
+
+	client := &http.Client{Transport: newTransport(), Timeout: timeout}
+	reply, err := client.Get(search.String())
+	if err != nil {
+		return unknown, fmt.Errorf("CT search: %w", err)
+	}
+	defer reply.Body.Close()
+	if reply.StatusCode != http.StatusOK {
+		return unknown, fmt.Errorf("CT search %s: %s", search.Host, reply.Status)
+	}
+	entries := []struct {
+		IssuerName string `json:"issuer_name"` // such as "C=US, O=Let's Encrypt, CN=R3"
+	}{}
+	err = json.NewDecoder(reply.Body).Decode(&entries)
+	if err != nil {
+		return unknown, fmt.Errorf("CT search %s: %w", search.Host, err)
+	}
+	// serial numbers are only unique for an issuer
+	issuerCN := "CN=" + leaf.Issuer.CommonName
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.IssuerName, ", ") {
+			if name == issuerCN {
+				return "logged", nil
+			}
+		}
+	}
+	return "not logged", nil
+}
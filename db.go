@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // registers driver "sqlite", which does not need cgo
+)
+
+// dbName is the SQLite database file to append certificate details of each run to, if not ""
+const dbNameFlag = "db"
+const dbNameText = "append the URL, serial number and expiry time of each certificate written " +
+	"to table certs in this SQLite database file, with the time of the run"
+
+var dbName string
+
+// db is the database opened from dbName, or nil if dbName == "".
+var db *sql.DB
+
+// CreateCertsTable creates table certs, with a row for each certificate written by a run,
+// if it does not already exist.
+const createCertsTable = `CREATE TABLE IF NOT EXISTS certs (
+	run          TEXT NOT NULL, -- time of the run, RFC 3339 in UTC
+	url          TEXT NOT NULL,
+	serialNumber TEXT NOT NULL, -- as written, in hexadecimal if given -hexserial
+	notAfter     TEXT NOT NULL  -- expiry time, RFC 3339 in UTC
+)`
+
+// OpenDB opens the SQLite database in file name, creating it and table certs if need be,
+// returning db == the open database and err == nil.
+// If failed to open the database or create the table, openDB returns db == nil and err != nil.
+func openDB(name string) (db *sql.DB, err error) {
+	db, err = sql.Open("sqlite", name)
+	if err == nil {
+		_, err = db.Exec(createCertsTable)
+	}
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, fmt.Errorf("%s %q: %w", os.Args[0], name, err)
+	}
+	return db, nil
+}
+
+// SaveDetails appends a row to table certs in db for each of details, for the run at time run,
+// in one transaction so a run is saved entirely or not at all, returning err == nil.
+// If failed, saveDetails returns err != nil.
+func saveDetails(db *sql.DB, run time.Time, details []certDetail) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", os.Args[0], dbName, err)
+	}
+	defer tx.Rollback() // does nothing after commit
+	runStr := run.UTC().Format(time.RFC3339)
+	for _, detail := range details {
+		_, err = tx.Exec("INSERT INTO certs (run, url, serialNumber, notAfter) VALUES (?, ?, ?, ?)",
+			runStr, detail.URL, detail.SerialNumber, detail.Expires.UTC().Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("%s %q: %w", os.Args[0], dbName, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", os.Args[0], dbName, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+// if htmlOut == true then write certificate details as an HTML page instead of CSV
+const htmlFlag = "html"
+const htmlText = "write certificate details as an HTML page with a table, each row colored by " +
+	"how soon its certificate expires: red within -w, yellow within a month, otherwise green"
+
+var htmlOut bool
+
+// HTMLPage is the template of the HTML page written by writeHTML,
+// which escapes the values of fields.
+var htmlPage = template.Must(template.New(htmlFlag).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Certificates</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; text-align: left; }
+tr.red { background: #f8d7da; }
+tr.yellow { background: #fff3cd; }
+tr.green { background: #d4edda; }
+tr.error { background: #e2e3e5; }
+</style>
+</head>
+<body>
+<h1>Certificates</h1>
+<p>Listed {{.Listed}}</p>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr class="{{.Class}}">{{range .Fields}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// HTMLRow is a row of the table in htmlPage.
+type htmlRow struct {
+	Class  string   // of the row: red, yellow, green or error
+	Fields []string // of a certificate detail or URL error
+}
+
+// WriteHTML writes urlErrs then details to output as an HTML page with a table,
+// each row colored red if its certificate has expired or expires within warn,
+// yellow if within a month, otherwise green.
+// If failed to write, writeHTML will write the error to standard error then exit the program.
+func writeHTML(details []certDetail, urlErrs []urlError) {
+	now := time.Now()
+	rows := []htmlRow{}
+	for _, urlErr := range urlErrs {
+		rows = append(rows, htmlRow{"error", urlErr.fields()})
+	}
+	for _, detail := range details {
+		rows = append(rows, htmlRow{getUrgency(detail.Expires, now), detail.fields()})
+	}
+
+	out := bufio.NewWriter(output)
+	err := htmlPage.Execute(out, struct {
+		Listed string
+		Header []string
+		Rows   []htmlRow
+	}{now.UTC().Format(time.RFC1123), header(), rows})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		os.Exit(ioExit)
+	}
+}
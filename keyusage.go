@@ -0,0 +1,89 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/x509"
+)
+
+// if usages == true then write the key usages and extended key usages of each certificate
+const usagesFlag = "usage"
+const usagesText = "write the key usages and extended key usages of each certificate, " +
+	"such as digitalSignature and serverAuth"
+
+var usages bool
+
+// KeyUsages are the names of key usages, from RFC 5280, in order of their bits.
+var keyUsages = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+// ExtKeyUsages maps extended key usages to their names, from RFC 5280 where named there.
+var extKeyUsages = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "msSGC",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "nsSGC",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "msCodeCom",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "msKernelCodeSigning",
+}
+
+// GetKeyUsage returns the names of the key usages of cert.
+func getKeyUsage(cert *x509.Certificate) (names []string) {
+	for _, keyUsage := range keyUsages {
+		if cert.KeyUsage&keyUsage.usage != 0 {
+			names = append(names, keyUsage.name)
+		}
+	}
+	return names
+}
+
+// GetExtKeyUsage returns the names of the extended key usages of cert,
+// with those Go does not know as object identifiers, such as 1.3.6.1.5.5.7.3.17.
+func getExtKeyUsage(cert *x509.Certificate) (names []string) {
+	for _, extKeyUsage := range cert.ExtKeyUsage {
+		name, ok := extKeyUsages[extKeyUsage]
+		if ok == false {
+			continue // cannot get here unless Go adds extended key usages
+		}
+		names = append(names, name)
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// if listURL != "" then read URLs from the list at this HTTP or HTTPS URL as well as any files
+const listURLFlag = "list"
+const listURLText = "read URLs from the list at this HTTP or HTTPS URL, " +
+	"such as https://inventory.example.com/urls.txt, as well as from any files"
+
+var listURL string
+
+// GetList gets the list of URLs at listURL,
+// returning list == the list, in the format given by inputFormat, and err == nil.
+// If failed to get the list, or the response status is not 200 OK,
+// getList returns list == nil and err != nil.
+func getList(listURL string) (list io.Reader, err error) {
+	client := &http.Client{Transport: newTransport(), Timeout: timeout}
+	reply, err := client.Get(listURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s list %w", os.Args[0], err)
+	}
+	defer reply.Body.Close()
+	if reply.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s list %q: %s", os.Args[0], listURL, reply.Status)
+	}
+	body, err := io.ReadAll(reply.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s list %q: %w", os.Args[0], listURL, err)
+	}
+	return bytes.NewReader(body), nil
+}
@@ -19,209 +19,2586 @@ along with this program. If not, see <https://www.gnu.org/licenses/>.
 Lscerts lists certificates in the order they will expire.
 
 It is a command line program that reads a list of HTTPS URLs
-from file or standard input, one URL per line.
-Lines that are blank or comment, starting "#", are ignored.
+from files or standard input, one URL per line.
+URLs can also be given as arguments, in place of or as well as files.
+An argument "-" reads standard input as well as files, such as lscerts saved.txt -.
+Leading and trailing white space is removed from each line.
+Lines that are blank or comment, starting "#" or as given with flag -comment, are ignored,
+as are URLs with the same scheme, host and port as an earlier URL.
+A comment at the end of a line after white space is removed, as in https://example.com # team X,
+though not a URL's fragment, such as https://example.com/#top.
+With flag -p, certificates are fetched from that many URLs at the same time,
+though only one at a time from the same host and port so as not to be rate limited.
+Fetching from each URL times out after 5 seconds, or as given with flag -t,
+or separately for connecting and the TLS handshake
+given flags -connect-timeout and -handshake-timeout,
+the handshake timing out as given with flag -t if only -connect-timeout is given.
+A URL may be followed by "|" and the server name to send in the TLS handshake (SNI)
+instead of the URL's host, for example https://192.0.2.1|www.example.com,
+which is not written as part of the URL.
+A URL's host can be an internationalized domain name, such as https://例え.jp,
+which is converted to punycode (xn--r8jz45g.jp) for DNS and the TLS handshake,
+so field url gives the name as read while error messages give the punycode.
+A line with just a host name and optional port, such as example.com:8443,
+is read as an HTTPS URL, or with the scheme given with flag -default-scheme, such as smtp.
+With flag -raw, each line is instead read as host:port of a service that starts with TLS,
+such as Redis or LDAPS, without a URL scheme.
+With flag -list, URLs are also read from a list at an HTTP or HTTPS URL,
+such as an inventory service.
+With flag -format json, input is instead a JSON array of objects,
+such as a host inventory, with the URL in field url and other fields ignored.
+With flag -upgrade, HTTP URLs are read as HTTPS URLs, with a warning.
+Lscerts also reads SMTP URLs, smtp://<host>[:<port>],
+fetching certificates after upgrading the connection with STARTTLS.
 For each URL, lscerts fetches and validates the list of X.509 certificates then
 writes the following details for the leaf certificate:
 
-  - expires:      expiry date of this certificate
+  - expires:      expiry date of this certificate in UTC,
+    with the time as well given flag -time, or in the format given with flag -timefmt
   - toExpiry:     time until this certificate expires:
-    hours, days, weeks or years rounded down to a whole number
+    hours, days, weeks or years rounded down to a whole number,
+    or just the number of days given flag -days
   - URL:          this certificate was fetched from
-  - serialNumber: of this certificate
+  - serialNumber: of this certificate in decimal,
+    or in uppercase hexadecimal bytes separated by colons given flag -hexserial,
+    shortened to its start and end around ... if longer than 64 characters,
+    as only in malformed certificates, or the length given with flag -serial-max
   - issuerCN:     common name (CN) of the CA that issued this certificate
 
-Certificate details are sorted by expiry date ascending.
+With flag -chain, details are written for every certificate in the chain
+fetched from each URL, with an extra field position: leaf, intermediate or root.
+With flag -select, details are written for just one other certificate in the chain,
+selected by position: intermediate, the first after the leaf, or root, which the URL
+might not send but the chain validates to, or by index from 0 for the leaf, such as 1.
+A URL whose chain has no such certificate fails.
+With flag -san, an extra field san lists the DNS subject alternative names
+of each certificate separated by spaces.
+With flag -org, an extra field issuerOrg gives the organization of the CA
+that issued each certificate, useful when the CA does not set a CN.
+With flag -wildcard, an extra field wildcard is true if any DNS name of
+each certificate is a wildcard, such as *.example.com, otherwise false.
+With flag -selfsigned, an extra field selfSigned is true if each certificate
+is issued by itself, as in development, which only validates if trusted with flag -cafile.
+With flag -path, an extra field path gives the subject CN of each certificate
+in the chain from the leaf to its root, such as leaf <- intermediate <- root,
+which shows which intermediates and cross-signed roots a URL chains through.
+With flag -fingerprint, an extra field fingerprint gives the SHA-256 fingerprint
+of each certificate in uppercase hexadecimal bytes separated by colons, as OpenSSL does.
+With flag -x, extra fields signatureAlgorithm and publicKey give
+the algorithm used to sign each certificate and its key's algorithm and size:
+bits for RSA, such as RSA 2048, the curve for ECDSA, such as ECDSA P-256, or just Ed25519.
+A signature algorithm using SHA-1 or MD5, which can be forged, is followed by WEAK.
+With flag -usage, extra fields keyUsage and extKeyUsage list, separated by spaces,
+the key usages and extended key usages of each certificate, such as serverAuth.
+
+With flag -k, certificates are listed even if they do not validate,
+with an extra field notValid giving the reason why, or empty if they are valid.
+Expired certificates are then listed first with toExpiry "expired",
+or given flag -days the negative number of days since they expired.
+With flag -notbefore, extra fields notBefore and toValid give the date
+each certificate becomes valid and, if not yet valid, the time until then.
+With flag -lifetime, extra fields lifetime and remaining give how long each certificate
+is valid for and the percentage of that remaining, rounded down.
+A warning is written to standard error for each intermediate certificate that expires
+before the leaf certificate, which stops validating then although not expired,
+and for each certificate signed with a weak algorithm using SHA-1 or MD5,
+which only validates with flag -k.
+With flag -serials, a warning is written to standard error for each serial number
+from more than one issuer, which might be a misissued or cloned certificate.
+With flag -renew, a warning is written to standard error for each certificate with less
+than the given percentage of its lifetime remaining, such as an ACME certificate not renewed.
+With flag -ocsp, an extra field ocsp gives whether the leaf certificate is revoked,
+asking its CA's OCSP responder: good, revoked or unknown.
+With flag -ct, an extra field ct gives whether the leaf certificate is publicly logged
+in Certificate Transparency, as public CAs must, by searching crt.sh or a compatible
+search given with flag -ct-search: logged, not logged or unknown.
+A certificate not logged was likely issued by a private CA.
+With flag -tls, extra fields tlsVersion and cipherSuite give
+the TLS version and cipher suite negotiated with each URL.
+Flags -min-tls and -max-tls limit the TLS versions offered to each URL, such as
+-max-tls 1.1 to find servers that still accept it, and a handshake with a URL
+that accepts none of them fails saying there was no TLS version in common.
+With flag -alpn, h2 and http/1.1 are offered to https URLs by ALPN and an extra field alpn
+gives the protocol negotiated, such as h2 for HTTP/2, or is empty if the server chose none.
+With flag -ip, an extra field remoteIP gives the IP address each certificate
+was fetched from, or the proxy's address given flag -proxy.
+With flag -all-ips, certificates are fetched from every IP address of each URL's host,
+with the host as server name, and field remoteIP is written.
+With flag -latency, an extra field latency gives how long the TLS handshake,
+in which each certificate was fetched, took, such as 12.345ms.
+
+Certificate details are sorted by expiry date ascending,
+or by URL or issuer given with flag -sort, and descending with flag -r.
+With flag -group issuer, details are written in sections, one per issuer,
+each headed by a comment line with the issuer CN and number of certificates
+instead of the header line, so flag -comment cannot be "", except a Markdown table or HTML page which is just sorted by issuer.
+With flag -within, only certificates that expire within the given duration are listed.
+With flag -weak-only, only certificates signed with a weak algorithm are listed.
+With flag -stream, details are written for each URL as soon as it is fetched,
+so are not sorted, which cannot be written as JSON, metrics or an HTML page, grouped or sorted
+with flags -sort and -r.
+They are written as CSV with a header line, with fields separated by commas
+or another character given with flag -sep, such as ; or |, and quoted if they contain it,
+or as tab separated values given flag -tsv,
+with tabs in values replaced by spaces, or as a Markdown table given flag -md,
+with pipes in values escaped, or as an HTML page given flag -html,
+with each row of its table colored by how soon the certificate expires:
+red within the duration given with flag -w, yellow within a month, otherwise green.
+CSV or tab separated values written to a terminal have their toExpiry field colored the same way,
+unless environment variable NO_COLOR is set.
+With flag -template, each certificate's details are instead written by executing
+a Go text/template, such as '{{.URL}} expires {{.Expires.Format "2006-01-02"}}',
+with fields Expires, ToExpiry, URL, SerialNumber, IssuerCN and those of the extra fields given.
+Given flag -json they are written as a JSON array of objects with the same fields
+and expires as an RFC 3339 time.
+With flag -db, the URL, serial number and expiry time of each certificate written
+are also appended to table certs in the given SQLite database file, with the time of the run,
+for finding certificates renewed since an earlier run, such as
+SELECT url FROM certs GROUP BY url HAVING COUNT(DISTINCT serialNumber) > 1.
+With flag -state, the serial number of each URL's certificate is remembered in the given
+JSON file and, on the next run, URLs whose serial number changed are written as renewed
+to standard error, with a warning for those not renewed that expire within flag -w, or a month.
+With flag -prom, they are instead written as Prometheus metrics,
+ssl_cert_not_after for each certificate and ssl_cert_fetch_error for each URL,
+for the node exporter's textfile collector.
+They are written to standard output, or to a file given with flag -o.
+With flag -errors, errors for URLs are written as records before the details,
+with an extra field error, instead of to standard error.
 Error messages for failing to read or parse HTTPS URLs and fetch or validate certificates
-are written to standard error.
+are written to standard error, or with flag -q just how many there were.
+Failures to fetch say why first, such as DNS lookup failed for a host that no longer exists,
+connection refused for a service that is down, connect or handshake timed out
+or certificate not valid.
+With flag -v, diagnostics for each URL fetched are written to standard error:
+the IP address connected to, TLS handshake, timing and certificate subjects.
+With flag -summary, a line counting the URLs checked, ok, failed and,
+given flag -w, with certificates expiring within the warning duration
+is written to standard error after the details.
 Lscerts trusts certificates issued by the same set of
-certificate authorities (CAs) as the operating system on which it runs.
+certificate authorities (CAs) as the operating system on which it runs,
+or only the CAs in a PEM file given with flag -cafile.
+A client certificate, for URLs that require mutual TLS, is given with flags -cert and -key.
+Certificates are fetched through an HTTP proxy given with flag -proxy,
+or an HTTP or SOCKS5 proxy given by environment variable HTTPS_PROXY or ALL_PROXY,
+except for loopback addresses and hosts in NO_PROXY, or with flag -all-ips,
+or through a SOCKS5 proxy, such as an SSH bastion, given with flag -socks5 as host:port.
+Connections are made from a local IP address given with flag -source,
+on a host with more than one.
+With flag -public-only, URLs for hosts with a private, loopback or link-local address
+are skipped, with a message to standard error, rather than fetched.
+
+Lscerts exits with status 5 if, given flag -w, any certificate fetched expires
+within the given duration, listed or not given flag -within or -weak-only, otherwise with status 6 if any URL failed to parse or fetch.
+With flag -strict, it exits with status 6 at the first URL that fails.
+With flag -require-input, it exits with status 3 if input has no URLs.
+With flag -check, it only parses each line, writing errors for those that fail
+and how many lines are valid and invalid, then exits with status 6 if any are invalid,
+without fetching certificates.
+With flag -exit-on, only the given causes, separated by commas, exit with status 5 or 6:
+parse-error for a URL that failed to parse, fetch-error for a URL that failed to fetch
+or validate and expiring for a certificate that expires within flag -w, or never for none.
+If interrupted, such as by Ctrl-C, it stops fetching, writes details of certificates
+fetched so far and exits with status 130, as does a program killed by SIGINT.
+Otherwise it exits with status 2 if a flag or argument is not valid,
+3 if a file or the list of URLs cannot be read and 4 if failed to read input or write details.
+With flags -w and -fail-fast, it writes details of the first certificate found
+that expires within the given duration then exits with status 5,
+without fetching from the remaining URLs.
+
+With flag -follow, certificates are fetched from the host that an https URL
+redirects to, if any, and field url is the URL redirected to.
 
-For help in using the program, run "lscerts -h".
+With flag -nagios, lscerts acts as a Nagios plugin checking one URL:
+it writes a status line, with days until the leaf certificate expires as performance data,
+and exits with status 0 OK, 1 WARNING if it expires within flag -w,
+2 CRITICAL if it expires within flag -c or failed to fetch, or 3 UNKNOWN,
+as it does if a flag after -nagios is not valid.
+
+Flags can also be given in environment variable LSCERTS_OPTS, separated by white space,
+such as LSCERTS_OPTS="-t 10s -json", which those on the command line override.
+
+For help in using the program, run "lscerts -h",
+and for its version, to give with bug reports, run "lscerts -version".
 */
 package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"net"
 	"net/url"
 	"os"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
-var input *os.File  // stream to read HTTPS URLs from
-const comment = '#' // first char on comment lines in input and certificate details header lines
+var inputs []io.Reader    // streams to read HTTPS URLs from, in order
+const serverNameSep = "|" // separates a URL from the server name to use instead of its host
+
+// if requireInput == true then exit with status 3 if input has no URLs
+const requireInputFlag = "require-input"
+const requireInputText = "exit with status 3 if input has no URLs, such as an empty file"
+
+var requireInput bool
+
+// if checkOnly == true then check that each line parses, without fetching certificates
+const checkOnlyFlag = "check"
+const checkOnlyText = "check that each line of input parses as a URL, without fetching certificates, " +
+	"writing how many lines are valid and invalid"
+
+var checkOnly bool
+
+// EnvFlagsName is the environment variable with flags to parse before those on the command line.
+const envFlagsName = "LSCERTS_OPTS"
+
+// comment starts comment lines in input and the certificate details header line,
+// if comment == "" then there are no comment lines
+const commentFlag = "comment"
+const commentText = "comment lines in input start with this, \"\" for none"
+
+var comment string
+
+// inputFormat is the format of input: linesFormat, one URL per line, or jsonFormat
+const inputFormatFlag = "format"
+const inputFormatText = "format of input: lines, one URL per line, " +
+	"or json, an array of objects with field url"
+const linesFormat = "lines"
+const jsonFormat = "json"
+
+var inputFormat string
+
+// if noHeader == true then do not write header for certificate details
+const noHeaderFlag = "n"
+const noHeaderText = "do not write header for certificate details"
+
+var noHeader bool
+
+// separator separates the fields of certificate details written as CSV
+const separatorFlag = "sep"
+const separatorText = "separate the fields of certificate details with this character, such as ; or |, " +
+	"quoting fields that contain it"
+
+var separator rune
+
+// if jsonOut == true then write certificate details as a JSON array instead of CSV
+const jsonFlag = "json"
+const jsonText = "write certificate details as a JSON array instead of CSV"
+
+var jsonOut bool
+
+// if errorsOut == true then write errors for URLs as records with certificate details,
+// instead of to standard error
+const errorsOutFlag = "errors"
+const errorsOutText = "write errors for URLs that fail as records with certificate details, " +
+	"rather than to standard error"
+
+var errorsOut bool
+
+// output is the stream to write certificate details to, by default standard output
+const outputFlag = "o"
+const outputText = "write certificate details to this file instead of standard output"
+
+var output = os.Stdout
+
+// timeout is how long fetchCert waits to connect to a URL and validate its certificates
+const timeoutFlag = "t"
+const timeoutText = "wait this long to fetch certificates from each URL, for example 10s or 500ms"
+
+var timeout time.Duration
+
+// if connectTimeout > 0 then fetchCert waits this long to connect, instead of within timeout,
+// then timeout for the TLS handshake unless handshakeTimeout > 0
+const connectTimeoutFlag = "connect-timeout"
+const connectTimeoutText = "wait this long to connect to each URL, instead of within -t"
+
+var connectTimeout time.Duration
+
+// if handshakeTimeout > 0 then fetchCert waits this long for the TLS handshake,
+// including any STARTTLS, once connected, instead of within timeout
+const handshakeTimeoutFlag = "handshake-timeout"
+const handshakeTimeoutText = "wait this long for the TLS handshake with each URL once connected, " +
+	"instead of within -t"
+
+var handshakeTimeout time.Duration
+
+// retries is how many more times fetchCert tries to fetch certificates after a transient error
+const retriesFlag = "retries"
+const retriesText = "try fetching certificates from each URL this many more times after a transient error, " +
+	"such as a timeout"
+
+var retries int
+
+// Exit statuses of the program, other than 0 when all is OK
+// and those of a Nagios plugin if nagios == true.
+const (
+	usageExit       = 2   // a flag or argument is not valid, as flag.Parse exits with
+	fileExit        = 3   // a file or the list could not be read, or input had no URLs
+	ioExit          = 4   // failed to read input or write certificate details
+	expiringExit    = 5   // a certificate expires within warn
+	failedExit      = 6   // a URL failed to parse or fetch
+	interruptedExit = 130 // interrupted by SIGINT, after writing details fetched so far
+)
+
+// GetUsageExit returns the exit status for a flag or argument that is not valid:
+// usageExit or, if nagios == true, nagiosUnknown as a Nagios plugin must,
+// rather than usageExit which Nagios takes as CRITICAL.
+func getUsageExit() (status int) {
+	if nagios {
+		return nagiosUnknown
+	}
+	return usageExit
+}
+
+// Causes of exiting with expiringExit or failedExit that can be in exitOn.
+const (
+	parseErrorCause = "parse-error" // a URL failed to parse
+	fetchErrorCause = "fetch-error" // a URL failed to fetch or validate
+	expiringCause   = "expiring"    // a certificate expires within warn
+	neverCause      = "never"       // on its own, none of the above
+)
+
+// exitOn is the causes, with a value of true, to exit with expiringExit or failedExit for
+const exitOnFlag = "exit-on"
+const exitOnText = "exit with status 5 or 6 on these causes, separated by commas: " +
+	parseErrorCause + ", " + fetchErrorCause + " and " + expiringCause + ", or " + neverCause
+
+var exitOn map[string]bool
+
+// if warn > 0 and any certificate expires within warn then exit with expiringExit
+const warnFlag = "w"
+const warnText = "exit with status 5 if any certificate expires within this long, for example 336h"
+
+var warn time.Duration
+
+// if failFast == true then exit with expiringExit at the first certificate that expires within warn
+const failFastFlag = "fail-fast"
+const failFastText = "with -w, write the first certificate found that expires within -w " +
+	"then exit with status 5, without fetching from the remaining URLs"
+
+var failFast bool
+
+// if within > 0 then only write details of certificates that expire within within
+const withinFlag = "within"
+const withinText = "only write details of certificates that expire within this long, for example 720h"
+
+var within time.Duration
+
+// if any URL fails to parse or fetch then exit with failedExit,
+// immediately if strict == true
+const strictFlag = "strict"
+const strictText = "exit with status 6 on the first URL that fails to parse or fetch, " +
+	"rather than after writing details"
+
+var strict bool
+
+// if quiet == true then do not write errors for URLs to standard error, just how many there were
+const quietFlag = "q"
+const quietText = "do not write errors for URLs that fail to standard error, just how many there were"
+
+var quiet bool
+
+// if verbose == true then write diagnostics for each URL fetched to standard error
+const verboseFlag = "v"
+const verboseText = "write the IP address, TLS handshake, timing and certificate subjects " +
+	"for each URL fetched to standard error"
+
+var verbose bool
+
+// if upgrade == true then fetch certificates for http URLs as if they were https
+const upgradeFlag = "upgrade"
+const upgradeText = "fetch certificates for http URLs as if they were https, with a warning"
+
+var upgrade bool
+
+// defaultScheme is the scheme of URLs given as just a host name and optional port
+const defaultSchemeFlag = "default-scheme"
+const defaultSchemeText = "read lines with just a host name and optional port as URLs with this scheme: " +
+	"https or smtp"
+
+var defaultScheme string
+
+// if raw == true then read each line as the host and port of a TLS service, not a URL
+const rawFlag = "raw"
+const rawText = "read each line as host:port of a service that starts with TLS, " +
+	"such as Redis or LDAPS, rather than a URL"
+
+// RawScheme is the scheme of services read as host:port if raw == true.
+const rawScheme = "tls"
+
+var raw bool
+
+// if progress == true then write how many URLs have been fetched to standard error
+const progressFlag = "progress"
+const progressText = "write how many URLs have been fetched so far to standard error"
+
+var progress bool
+
+// if summary == true then write counts of URLs checked, ok, failed and expiring soon to standard error
+const summaryFlag = "summary"
+const summaryText = "write a line counting URLs checked, ok, failed and expiring within -w to standard error"
+
+var summary bool
+
+// if fullTime == true then write the expiry time as well as the date
+const fullTimeFlag = "time"
+const fullTimeText = "write the expiry time (UTC) as well as the date"
+
+var fullTime bool
+
+// if inDays == true then write time until expiry as a whole number of days
+const inDaysFlag = "days"
+const inDaysText = "write the time until each certificate expires as a whole number of days"
+
+var inDays bool
+
+// timeFormat is how to write the expiry time: a name in timeLayouts, "unix" or a Go layout
+const timeFormatFlag = "timefmt"
+const timeFormatText = "write the expiry time in this format: date, datetime, rfc3339, unix " +
+	"(seconds since 1970) or a Go layout such as \"02 Jan 2006\""
+const unixFormat = "unix"
+
+var timeFormat string
+var expiresLayout string // Go layout for timeFormat, or unixFormat
+
+// TimeLayouts maps named time formats to their Go layouts.
+var timeLayouts = map[string]string{
+	"date":     time.DateOnly,
+	"datetime": time.DateTime,
+	"rfc3339":  time.RFC3339,
+}
+
+// if chain == true then write details for every certificate fetched, not just the leaf
+const chainFlag = "chain"
+const chainText = "write details for every certificate in each URL's chain, not just the leaf"
+
+var chain bool
+
+// certSelector selects which certificate in each URL's chain to write details for, if chain == false
+const certSelectorFlag = "select"
+const certSelectorText = "write details for this certificate in each URL's chain: " +
+	"leaf, intermediate, root or an index from 0 for the leaf"
+
+var certSelector string
+
+// if san == true then write the subject alternative names of each certificate
+const sanFlag = "san"
+const sanText = "write the DNS subject alternative names (SANs) of each certificate"
+
+var san bool
+
+// if org == true then write the organization of the CA that issued each certificate
+const orgFlag = "org"
+const orgText = "write the organization of the CA that issued each certificate"
+
+var org bool
+
+// if wildcard == true then write whether each certificate has a wildcard DNS name
+const wildcardFlag = "wildcard"
+const wildcardText = "write whether each certificate has a wildcard DNS name, such as *.example.com"
+
+var wildcard bool
+
+// if selfSigned == true then write whether each certificate is self-signed
+const selfSignedFlag = "selfsigned"
+const selfSignedText = "write whether each certificate is self-signed, " +
+	"issued by itself as is common in development, use with -k"
+
+var selfSigned bool
+
+// if path == true then write the subjects of the chain from each leaf certificate to its root
+const pathFlag = "path"
+const pathText = "write the subjects of the chain from each leaf certificate to its root, " +
+	"such as leaf <- intermediate <- root"
+
+var path bool
+
+// if serials == true then warn of any serial number from more than one issuer
+const serialsFlag = "serials"
+const serialsText = "warn of any serial number from more than one issuer, " +
+	"which might be a misissued or cloned certificate"
+
+var serials bool
+
+// if hexSerial == true then write serial numbers in hexadecimal, as browsers and OpenSSL do
+const hexSerialFlag = "hexserial"
+const hexSerialText = "write serial numbers in uppercase hexadecimal bytes separated by colons, " +
+	"such as 0A:1B:2C, instead of decimal"
+
+var hexSerial bool
+
+// serialMax is the most characters of a serial number to write, if not 0
+const serialMaxFlag = "serial-max"
+const serialMaxText = "shorten serial numbers longer than this many characters, as in malformed certificates, " +
+	"to their start and end around ..., 0 for never"
+
+var serialMax int
+
+// if fingerprint == true then write the SHA-256 fingerprint of each certificate
+const fingerprintFlag = "fingerprint"
+const fingerprintText = "write the SHA-256 fingerprint of each certificate"
+
+var fingerprint bool
+
+// if crypto == true then write the signature algorithm and public key of each certificate
+const cryptoFlag = "x"
+const cryptoText = "write the signature algorithm and public key type and size of each certificate"
+
+var crypto bool
+
+// if insecure == true then write details of certificates that do not validate
+const insecureFlag = "k"
+const insecureText = "write details of certificates that do not validate, with the reason why"
+
+var insecure bool
+
+// if rootCAs != nil then trust only the CAs in it, read from file caFile,
+// instead of the operating system's CAs
+const caFileFlag = "cafile"
+const caFileText = "trust only the CAs in this PEM file instead of the operating system's CAs"
+
+var caFile string
+var rootCAs *x509.CertPool
+
+// if clientCerts != nil then present this certificate, read from files certFile and keyFile,
+// to URLs that ask for one (mutual TLS)
+const certFileFlag = "cert"
+const certFileText = "present the client certificate in this PEM file to URLs that ask for one"
+const keyFileFlag = "key"
+const keyFileText = "private key, in a PEM file, of the client certificate given with -cert"
+
+var certFile, keyFile string
+var clientCerts []tls.Certificate
+
+// if notBefore == true then write when each certificate becomes valid
+const notBeforeFlag = "notbefore"
+const notBeforeText = "write the date each certificate becomes valid and, " +
+	"for certificates not yet valid, the time until then"
+
+var notBefore bool
+
+// if lifetime == true then write the lifetime of each certificate and the percentage left
+const lifetimeFlag = "lifetime"
+const lifetimeText = "write the lifetime of each certificate, from valid to expiry, " +
+	"and the percentage of it remaining"
+
+var lifetime bool
+
+// if renewBelow > 0 then warn of certificates with less than this percentage of their lifetime remaining
+const renewBelowFlag = "renew"
+const renewBelowText = "warn of certificates with less than this percentage of their lifetime remaining, " +
+	"for example 30 for a 90 day certificate not renewed with 27 days to go"
+
+var renewBelow int
+
+// if connection == true then write the TLS version and cipher suite negotiated with each URL
+const connectionFlag = "tls"
+const connectionText = "write the TLS version and cipher suite negotiated with each URL"
+
+var connection bool
+
+// if alpn == true then offer HTTP/2 and HTTP/1.1 to https URLs and write which was negotiated
+const alpnFlag = "alpn"
+const alpnText = "offer h2 and http/1.1 by ALPN to https URLs and write the protocol negotiated, if any"
+
+// ALPNProtocols are offered to https URLs if alpn == true, preferring HTTP/2.
+var alpnProtocols = []string{"h2", "http/1.1"}
+
+var alpn bool
+
+// if connectedIP == true then write the IP address each certificate was fetched from
+const connectedIPFlag = "ip"
+const connectedIPText = "write the IP address each certificate was fetched from, " +
+	"useful for a host with more than one, or the proxy's given -proxy"
+
+var connectedIP bool
+
+// if allIPs == true then fetch certificates from every IP address of each URL's host
+const allIPsFlag = "all-ips"
+const allIPsText = "fetch certificates from every IP address of each URL's host, " +
+	"writing the address as with -ip"
+
+var allIPs bool
+
+// if latency == true then write how long the TLS handshake took for each certificate
+const latencyFlag = "latency"
+const latencyText = "write how long the TLS handshake, in which each certificate was fetched, took"
+
+var latency bool
+
+// TLSVersions maps TLS versions to how they are written.
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS1.0",
+	tls.VersionTLS11: "TLS1.1",
+	tls.VersionTLS12: "TLS1.2",
+	tls.VersionTLS13: "TLS1.3",
+}
+
+// minTLS is the lowest TLS version to offer each URL, if not 0
+const minTLSFlag = "min-tls"
+const minTLSText = "offer each URL TLS versions from this one: 1.0, 1.1, 1.2 or 1.3, " +
+	"by default 1.2 or 1.0 if -max-tls is below that"
+
+var minTLS uint16
+
+// maxTLS is the highest TLS version to offer each URL, if not 0
+const maxTLSFlag = "max-tls"
+const maxTLSText = "offer each URL TLS versions up to this one: 1.0, 1.1, 1.2 or 1.3, by default 1.3"
+
+var maxTLS uint16
+
+// sortField is the field that certificate details are sorted by, ascending
+const sortFlag = "sort"
+const sortText = "sort certificate details by field: expiry, url or issuer"
+
+var sortField string
+
+// if reverse == true then sort certificate details descending
+const reverseFlag = "r"
+const reverseText = "sort certificate details descending, for example latest expiry first"
+
+var reverse bool
+
+// if groupBy == "issuer" then write certificate details in sections, one per issuer
+const groupByFlag = "group"
+const groupByText = "write certificate details in sections headed by each issuer: issuer"
+const groupByIssuer = "issuer"
+
+var groupBy string
+
+// LessBy maps sortField values to a function that reports whether
+// certificate detail a sorts before b.
+// Details equal in that field are sorted by expiry then URL, so output is the same every run.
+var lessBy = map[string]func(a, b certDetail) bool{
+	"expiry": lessByExpiry,
+	"url":    lessByURL,
+	"issuer": lessByIssuer,
+}
+
+// LessByExpiry reports whether a expires before b or, if they expire at the same time,
+// a's URL sorts before b's.
+func lessByExpiry(a, b certDetail) bool {
+	if a.Expires.Equal(b.Expires) == false {
+		return a.Expires.Before(b.Expires)
+	}
+	return a.URL < b.URL
+}
+
+// LessByURL reports whether a's URL sorts before b's or, if they are equal,
+// a expires before b.
+func lessByURL(a, b certDetail) bool {
+	if a.URL != b.URL {
+		return a.URL < b.URL
+	}
+	return a.Expires.Before(b.Expires)
+}
+
+// LessByIssuer reports whether a's issuer CN sorts before b's or, if they are equal,
+// a sorts before b by lessByExpiry.
+func lessByIssuer(a, b certDetail) bool {
+	if a.IssuerCN != b.IssuerCN {
+		return a.IssuerCN < b.IssuerCN
+	}
+	return lessByExpiry(a, b)
+}
+
+// CertDetail is the details of a valid leaf certificate fetched from a URL.
+type certDetail struct {
+	Expires      time.Time  `json:"expires"`                      // expiry time of this certificate, in UTC
+	ToExpiry     string     `json:"toExpiry"`                     // time until this certificate expires
+	URL          string     `json:"url"`                          // this certificate was fetched from
+	SerialNumber string     `json:"serialNumber"`                 // of this certificate
+	IssuerCN     string     `json:"issuerCN"`                     // common name of the CA that issued this certificate
+	Position     string     `json:"position,omitempty"`           // in chain: leaf, intermediate or root
+	Path         []string   `json:"path,omitempty"`               // subjects of the chain from leaf to root
+	SAN          []string   `json:"san,omitempty"`                // DNS subject alternative names of this certificate
+	IssuerOrg    []string   `json:"issuerOrg,omitempty"`          // organization of the CA that issued this certificate
+	Wildcard     *bool      `json:"wildcard,omitempty"`           // any DNS name of this certificate starts "*."
+	SelfSigned   *bool      `json:"selfSigned,omitempty"`         // this certificate is issued by itself
+	Fingerprint  string     `json:"fingerprint,omitempty"`        // SHA-256 of this certificate
+	SignatureAlg string     `json:"signatureAlgorithm,omitempty"` // used by the issuer to sign this certificate
+	PublicKey    string     `json:"publicKey,omitempty"`          // algorithm and size of this certificate's key
+	KeyUsage     []string   `json:"keyUsage,omitempty"`           // what this certificate's key may be used for
+	ExtKeyUsage  []string   `json:"extKeyUsage,omitempty"`        // what else this certificate may be used for
+	NotValid     string     `json:"notValid,omitempty"`           // why this certificate's chain did not validate
+	NotBefore    *time.Time `json:"notBefore,omitempty"`          // this certificate is valid from, in UTC
+	ToValid      string     `json:"toValid,omitempty"`            // time until this certificate is valid, if not yet
+	Lifetime     string     `json:"lifetime,omitempty"`           // from when this certificate is valid to expiry
+	Remaining    *int       `json:"remaining,omitempty"`          // percentage of this certificate's lifetime left
+	OCSP         string     `json:"ocsp,omitempty"`               // leaf certificate revocation status
+	CT           string     `json:"ct,omitempty"`                 // leaf certificate is in CT logs
+	TLSVersion   string     `json:"tlsVersion,omitempty"`         // negotiated with the URL
+	ALPN         string     `json:"alpn,omitempty"`               // application protocol negotiated with the URL
+	CipherSuite  string     `json:"cipherSuite,omitempty"`        // negotiated with the URL
+	RemoteIP     string     `json:"remoteIP,omitempty"`           // address this certificate was fetched from
+	Latency      string     `json:"latency,omitempty"`            // of the TLS handshake this certificate was fetched in
+
+	weak bool // this certificate is signed with a weak algorithm, if weakOnly == true
+}
+
+// URLError is an error for a URL that failed to parse or fetch,
+// written as a record if errorsOut == true.
+type urlError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// NewURLError returns err for url as a urlError.
+func newURLError(url string, err error) urlError {
+	// the record names the URL so the program name is not needed
+	message := strings.TrimPrefix(err.Error(), os.Args[0]+" ")
+	return urlError{URL: url, Error: message}
+}
+
+// Fields returns urlErr as a list of strings in the order of the header for CSV,
+// with only the URL and error fields set.
+func (urlErr urlError) fields() []string {
+	const urlI = 2 // index of URL in header
+	fields := make([]string, len(header()))
+	fields[urlI] = urlErr.URL
+	fields[len(fields)-1] = urlErr.Error
+	return fields
+}
+
+// NewCertDetail returns the details of cert fetched from url.
+func newCertDetail(url string, cert *x509.Certificate) certDetail {
+	detail := certDetail{
+		Expires:      cert.NotAfter,
+		ToExpiry:     getToExpiry(cert.NotAfter),
+		URL:          url,
+		SerialNumber: getSerialNumber(cert),
+		IssuerCN:     cert.Issuer.CommonName,
+	}
+	if san {
+		detail.SAN = cert.DNSNames
+	}
+	if org {
+		detail.IssuerOrg = cert.Issuer.Organization
+	}
+	if wildcard {
+		hasWildcard := false
+		for _, name := range cert.DNSNames {
+			hasWildcard = hasWildcard || strings.HasPrefix(name, "*.")
+		}
+		detail.Wildcard = &hasWildcard
+	}
+	if selfSigned {
+		isSelf := isSelfSigned(cert)
+		detail.SelfSigned = &isSelf
+	}
+	if fingerprint {
+		sum := sha256.Sum256(cert.Raw)
+		detail.Fingerprint = getHexBytes(sum[:])
+	}
+	if notBefore {
+		detail.NotBefore = &cert.NotBefore
+		detail.ToValid = getToValid(cert.NotBefore)
+	}
+	if lifetime {
+		detail.Lifetime = roundDown(cert.NotBefore, cert.NotAfter)
+		remaining := getRemaining(cert)
+		detail.Remaining = &remaining
+	}
+	if crypto {
+		detail.SignatureAlg = getSignatureAlg(cert)
+		detail.PublicKey = getPublicKey(cert)
+	}
+	if usages {
+		detail.KeyUsage = getKeyUsage(cert)
+		detail.ExtKeyUsage = getExtKeyUsage(cert)
+	}
+	if weakOnly {
+		detail.weak = isWeakSigned(cert)
+	}
+	return detail
+}
+
+// GetSubjectPath returns the subject CN, or whole subject if it has no CN,
+// of each certificate in the first chain from the leaf certificate to a trusted root in state,
+// or as fetched if the chain was not verified, as when insecure == true.
+func getSubjectPath(state tls.ConnectionState) (subjects []string) {
+	certs := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certs = state.VerifiedChains[0]
+	}
+	for _, cert := range certs {
+		subject := cert.Subject.CommonName
+		if subject == "" {
+			subject = cert.Subject.String()
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
+
+// Header returns the names of the fields of certificate details for CSV.
+func header() []string {
+	names := []string{"expires", "toExpiry", "URL", "serialNumber", "issuerCN"}
+	if chain {
+		names = append(names, "position")
+	}
+	if san {
+		names = append(names, "san")
+	}
+	if org {
+		names = append(names, "issuerOrg")
+	}
+	if wildcard {
+		names = append(names, "wildcard")
+	}
+	if selfSigned {
+		names = append(names, "selfSigned")
+	}
+	if path {
+		names = append(names, "path")
+	}
+	if fingerprint {
+		names = append(names, "fingerprint")
+	}
+	if crypto {
+		names = append(names, "signatureAlgorithm", "publicKey")
+	}
+	if usages {
+		names = append(names, "keyUsage", "extKeyUsage")
+	}
+	if insecure {
+		names = append(names, "notValid")
+	}
+	if notBefore {
+		names = append(names, "notBefore", "toValid")
+	}
+	if lifetime {
+		names = append(names, "lifetime", "remaining")
+	}
+	if checkOCSP {
+		names = append(names, "ocsp")
+	}
+	if checkCT {
+		names = append(names, "ct")
+	}
+	if connection {
+		names = append(names, "tlsVersion", "cipherSuite")
+	}
+	if alpn {
+		names = append(names, "alpn")
+	}
+	if connectedIP {
+		names = append(names, "remoteIP")
+	}
+	if latency {
+		names = append(names, "latency")
+	}
+	if errorsOut {
+		names = append(names, "error")
+	}
+	return names
+}
+
+// GivenFlag is the name of a flag and whether it was given, or set to other than its default.
+type givenFlag struct {
+	name  string
+	given bool
+}
+
+// GetConflict returns the name of the first flag in others that was given,
+// so cannot be used with another flag, or "" if none were given.
+func getConflict(others ...givenFlag) (name string) {
+	for _, other := range others {
+		if other.given {
+			return other.name
+		}
+	}
+	return ""
+}
+
+// GetLayout returns layout == the Go layout for format,
+// a name in timeLayouts, unixFormat or a Go layout, and err == nil.
+// If format is not a name and has no date or time elements,
+// getLayout returns layout == "" and err != nil.
+func getLayout(format string) (layout string, err error) {
+	layout, ok := timeLayouts[format]
+	switch {
+	case ok:
+		return layout, nil
+	case format == unixFormat:
+		return unixFormat, nil
+	}
+
+	sample := time.Date(2023, time.March, 14, 15, 9, 26, 0, time.UTC)
+	formatted := sample.Format(format)
+	_, err = time.Parse(format, formatted)
+	if (formatted == format) || (err != nil) {
+		return "", fmt.Errorf("%s %q: time format not a name or Go layout", os.Args[0], format)
+	}
+	return format, nil
+}
+
+// FormatExpires returns expires, or another certificate time, in UTC formatted with expiresLayout.
+func formatExpires(expires time.Time) string {
+	if expiresLayout == unixFormat {
+		return strconv.FormatInt(expires.Unix(), 10)
+	}
+	return expires.UTC().Format(expiresLayout)
+}
+
+// Fields returns detail as a list of strings in the order of the header for CSV.
+func (detail certDetail) fields() []string {
+	fields := []string{formatExpires(detail.Expires), detail.ToExpiry,
+		detail.URL, detail.SerialNumber, detail.IssuerCN}
+	if chain {
+		fields = append(fields, detail.Position)
+	}
+	if san {
+		// space cannot be in a DNS name so separates names in one CSV field
+		fields = append(fields, strings.Join(detail.SAN, " "))
+	}
+	if org {
+		// an organization name can contain spaces or commas but rarely semicolons
+		fields = append(fields, strings.Join(detail.IssuerOrg, "; "))
+	}
+	if wildcard {
+		fields = append(fields, strconv.FormatBool(*detail.Wildcard))
+	}
+	if selfSigned {
+		fields = append(fields, strconv.FormatBool(*detail.SelfSigned))
+	}
+	if path {
+		fields = append(fields, strings.Join(detail.Path, " <- "))
+	}
+	if fingerprint {
+		fields = append(fields, detail.Fingerprint)
+	}
+	if crypto {
+		fields = append(fields, detail.SignatureAlg, detail.PublicKey)
+	}
+	if usages {
+		// usage names do not contain spaces
+		fields = append(fields, strings.Join(detail.KeyUsage, " "), strings.Join(detail.ExtKeyUsage, " "))
+	}
+	if insecure {
+		fields = append(fields, detail.NotValid)
+	}
+	if notBefore {
+		fields = append(fields, formatExpires(*detail.NotBefore), detail.ToValid)
+	}
+	if lifetime {
+		fields = append(fields, detail.Lifetime, fmt.Sprintf("%d%%", *detail.Remaining))
+	}
+	if checkOCSP {
+		fields = append(fields, detail.OCSP)
+	}
+	if checkCT {
+		fields = append(fields, detail.CT)
+	}
+	if connection {
+		fields = append(fields, detail.TLSVersion, detail.CipherSuite)
+	}
+	if alpn {
+		fields = append(fields, detail.ALPN)
+	}
+	if connectedIP {
+		fields = append(fields, detail.RemoteIP)
+	}
+	if latency {
+		fields = append(fields, detail.Latency)
+	}
+	if errorsOut {
+		fields = append(fields, "")
+	}
+	return fields
+}
+
+// ParseFlags processes flags, from LSCERTS_OPTS then the command line, and arguments
+// setting inputs and the flag variables.
+// It is called by main, rather than being init, so that go test can parse its own flags.
+// Each argument is a file of URLs, "-" for standard input
+// or, if no such file exists and it contains "://", a URL.
+// If listURL != "", the list of URLs there is read before any arguments.
+// If a file argument cannot be opened, parseFlags writes the error to standard error
+// then continues with the remaining arguments.
+// If a flag is undefined or not valid, help was requested, the output file cannot be created,
+// the CA or client certificate files or list of URLs cannot be read or
+// none of the file arguments can be opened, parseFlags will exit the program.
+func parseFlags() {
+	const helpFlag = "h"
+	const helpText = "write this help text then exit"
+	var help bool
+	flag.BoolVar(&help, helpFlag, false, helpText)
+	flag.BoolVar(&showVersion, versionFlag, false, versionText)
+	flag.BoolVar(&noHeader, noHeaderFlag, false, noHeaderText)
+	var separatorStr string
+	flag.StringVar(&separatorStr, separatorFlag, ",", separatorText)
+	flag.StringVar(&comment, commentFlag, "#", commentText)
+	flag.StringVar(&inputFormat, inputFormatFlag, linesFormat, inputFormatText)
+	flag.StringVar(&listURL, listURLFlag, "", listURLText)
+	flag.BoolVar(&requireInput, requireInputFlag, false, requireInputText)
+	flag.BoolVar(&checkOnly, checkOnlyFlag, false, checkOnlyText)
+	flag.BoolVar(&jsonOut, jsonFlag, false, jsonText)
+	flag.BoolVar(&promOut, promFlag, false, promText)
+	flag.BoolVar(&tsvOut, tsvFlag, false, tsvText)
+	flag.BoolVar(&mdOut, mdFlag, false, mdText)
+	flag.BoolVar(&htmlOut, htmlFlag, false, htmlText)
+	var templateStr string
+	flag.StringVar(&templateStr, templateFlag, "", templateText)
+	flag.BoolVar(&errorsOut, errorsOutFlag, false, errorsOutText)
+	var outputName string
+	flag.StringVar(&outputName, outputFlag, "", outputText)
+	flag.StringVar(&dbName, dbNameFlag, "", dbNameText)
+	flag.StringVar(&stateName, stateNameFlag, "", stateNameText)
+	flag.DurationVar(&timeout, timeoutFlag, 5*time.Second, timeoutText)
+	flag.DurationVar(&connectTimeout, connectTimeoutFlag, 0, connectTimeoutText)
+	flag.DurationVar(&handshakeTimeout, handshakeTimeoutFlag, 0, handshakeTimeoutText)
+	flag.IntVar(&retries, retriesFlag, 0, retriesText)
+	flag.DurationVar(&warn, warnFlag, 0, warnText)
+	flag.BoolVar(&failFast, failFastFlag, false, failFastText)
+	flag.DurationVar(&within, withinFlag, 0, withinText)
+	flag.BoolVar(&weakOnly, weakOnlyFlag, false, weakOnlyText)
+	flag.BoolVar(&strict, strictFlag, false, strictText)
+	var exitOnStr string
+	flag.StringVar(&exitOnStr, exitOnFlag,
+		strings.Join([]string{parseErrorCause, fetchErrorCause, expiringCause}, ","), exitOnText)
+	flag.BoolVar(&quiet, quietFlag, false, quietText)
+	flag.BoolVar(&verbose, verboseFlag, false, verboseText)
+	flag.BoolVar(&upgrade, upgradeFlag, false, upgradeText)
+	flag.StringVar(&defaultScheme, defaultSchemeFlag, "https", defaultSchemeText)
+	flag.BoolVar(&raw, rawFlag, false, rawText)
+	flag.BoolVar(&follow, followFlag, false, followText)
+	flag.BoolVar(&progress, progressFlag, false, progressText)
+	flag.IntVar(&parallel, parallelFlag, 1, parallelText)
+	flag.BoolVar(&summary, summaryFlag, false, summaryText)
+	flag.BoolVar(&fullTime, fullTimeFlag, false, fullTimeText)
+	flag.BoolVar(&inDays, inDaysFlag, false, inDaysText)
+	flag.StringVar(&timeFormat, timeFormatFlag, "date", timeFormatText)
+	flag.BoolVar(&chain, chainFlag, false, chainText)
+	flag.StringVar(&certSelector, certSelectorFlag, "leaf", certSelectorText)
+	flag.BoolVar(&san, sanFlag, false, sanText)
+	flag.BoolVar(&org, orgFlag, false, orgText)
+	flag.BoolVar(&wildcard, wildcardFlag, false, wildcardText)
+	flag.BoolVar(&selfSigned, selfSignedFlag, false, selfSignedText)
+	flag.BoolVar(&path, pathFlag, false, pathText)
+	flag.BoolVar(&serials, serialsFlag, false, serialsText)
+	flag.BoolVar(&hexSerial, hexSerialFlag, false, hexSerialText)
+	// RFC 5280 serial numbers are at most 20 bytes, 49 decimal digits or 59 characters in hexadecimal
+	flag.IntVar(&serialMax, serialMaxFlag, 64, serialMaxText)
+	flag.BoolVar(&fingerprint, fingerprintFlag, false, fingerprintText)
+	flag.BoolVar(&usages, usagesFlag, false, usagesText)
+	flag.BoolVar(&crypto, cryptoFlag, false, cryptoText)
+	flag.BoolVar(&insecure, insecureFlag, false, insecureText)
+	flag.StringVar(&caFile, caFileFlag, "", caFileText)
+	flag.StringVar(&certFile, certFileFlag, "", certFileText)
+	flag.StringVar(&keyFile, keyFileFlag, "", keyFileText)
+	flag.BoolVar(&notBefore, notBeforeFlag, false, notBeforeText)
+	flag.BoolVar(&lifetime, lifetimeFlag, false, lifetimeText)
+	flag.IntVar(&renewBelow, renewBelowFlag, 0, renewBelowText)
+	flag.BoolVar(&checkOCSP, ocspFlag, false, ocspText)
+	flag.BoolVar(&checkCT, ctFlag, false, ctText)
+	flag.StringVar(&ctSearch, ctSearchFlag, "https://crt.sh/", ctSearchText)
+	flag.BoolVar(&nagios, nagiosFlag, false, nagiosText)
+	flag.DurationVar(&critical, criticalFlag, 0, criticalText)
+	flag.BoolVar(&connection, connectionFlag, false, connectionText)
+	var minTLSStr, maxTLSStr string
+	flag.StringVar(&minTLSStr, minTLSFlag, "", minTLSText)
+	flag.StringVar(&maxTLSStr, maxTLSFlag, "", maxTLSText)
+	flag.BoolVar(&alpn, alpnFlag, false, alpnText)
+	flag.BoolVar(&connectedIP, connectedIPFlag, false, connectedIPText)
+	flag.BoolVar(&allIPs, allIPsFlag, false, allIPsText)
+	flag.BoolVar(&latency, latencyFlag, false, latencyText)
+	var proxyStr string
+	flag.StringVar(&proxyStr, proxyFlag, "", proxyText)
+	var socks5Str string
+	flag.StringVar(&socks5Str, socks5Flag, "", socks5Text)
+	var sourceStr string
+	flag.StringVar(&sourceStr, sourceFlag, "", sourceText)
+	flag.BoolVar(&publicOnly, publicOnlyFlag, false, publicOnlyText)
+	flag.StringVar(&sortField, sortFlag, "expiry", sortText)
+	flag.BoolVar(&reverse, reverseFlag, false, reverseText)
+	flag.StringVar(&groupBy, groupByFlag, "", groupByText)
+	flag.BoolVar(&stream, streamFlag, false, streamText)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "\nUsage: %s [flag ...] [file|URL|- ...]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, `
+Lscerts lists certificates in the order they will expire.
+It reads a list of HTTPS URLs from files or standard input, one URL per line,
+or takes URLs as arguments. An argument - reads standard input as well as files.
+For each URL, it writes details of the leaf certificate or an error.
+			`)
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+	}
+	// parse continuing on error, so that getUsageExit chooses the exit status
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	parse := func(args []string) {
+		err := flag.CommandLine.Parse(args)
+		switch {
+		case err == flag.ErrHelp:
+			os.Exit(0) // as -h
+		case err != nil:
+			os.Exit(getUsageExit()) // Parse has written the error and usage
+		}
+	}
+	// flags from the environment come first so those on the command line override them
+	envFlags := strings.Fields(os.Getenv(envFlagsName))
+	parse(envFlags)
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "%s %s: %q not a flag\n", os.Args[0], envFlagsName, flag.Arg(0))
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	parse(os.Args[1:])
+
+	if help {
+		flag.Usage()
+		os.Exit(0)
+	}
+	if showVersion {
+		fmt.Println(getVersion())
+		os.Exit(0)
+	}
+	_, ok := lessBy[sortField]
+	_, defaultSchemeOK := defaultPorts[defaultScheme]
+	if (timeout <= 0) || (connectTimeout < 0) || (handshakeTimeout < 0) || (retries < 0) ||
+		(warn < 0) || (critical < 0) || (within < 0) || (ok == false) || (defaultSchemeOK == false) ||
+		((certFile == "") != (keyFile == "")) || ((groupBy != "") && (groupBy != groupByIssuer)) ||
+		((inputFormat != linesFormat) && (inputFormat != jsonFormat)) {
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if failFast && (warn == 0) {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s needs flag -%s\n", os.Args[0], failFastFlag, warnFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if allIPs && follow {
+		// a redirect is fetched from the host redirected to, not from each IP address
+		fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n", os.Args[0], allIPsFlag, followFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if chain && (certSelector != "leaf") {
+		fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+			os.Args[0], chainFlag, certSelectorFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if isCertSelector(certSelector) == false {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s %q is not leaf, intermediate, root or an index from 0\n",
+			os.Args[0], certSelectorFlag, certSelector)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if errorsOut && (templateStr != "") {
+		// a template is executed with certificate details, not errors
+		fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+			os.Args[0], errorsOutFlag, templateFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if (renewBelow < 0) || (100 < renewBelow) {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s is not a percentage from 0 to 100\n", os.Args[0], renewBelowFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if serialMax < 0 {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s is not 0, for never, or more\n", os.Args[0], serialMaxFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	formats := []givenFlag{{jsonFlag, jsonOut}, {promFlag, promOut}, {tsvFlag, tsvOut}, {mdFlag, mdOut},
+		{htmlFlag, htmlOut}, {templateFlag, templateStr != ""}}
+	for i, format := range formats {
+		conflict := getConflict(formats[i+1:]...)
+		if format.given && (conflict != "") {
+			// details are written in just one format
+			fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+				os.Args[0], format.name, conflict)
+			flag.Usage()
+			os.Exit(getUsageExit())
+		}
+	}
+	records := (jsonOut || promOut || mdOut || htmlOut || (templateStr != "")) == false
+	if (groupBy != "") && (comment == "") && records {
+		// else section headers would be written as if records
+		fmt.Fprintf(os.Stderr, "%s: flag -%s needs flag -%s, to start each section header line\n",
+			os.Args[0], groupByFlag, commentFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if parallel < 1 {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s is not 1 or more\n", os.Args[0], parallelFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if stream {
+		conflict := getConflict(givenFlag{jsonFlag, jsonOut}, givenFlag{promFlag, promOut},
+			givenFlag{htmlFlag, htmlOut}, givenFlag{errorsOutFlag, errorsOut},
+			givenFlag{failFastFlag, failFast}, givenFlag{groupByFlag, groupBy != ""},
+			givenFlag{sortFlag, sortField != "expiry"}, givenFlag{reverseFlag, reverse})
+		if conflict != "" {
+			// details written as each URL is fetched cannot be sorted or written as a whole
+			fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+				os.Args[0], streamFlag, conflict)
+			flag.Usage()
+			os.Exit(getUsageExit())
+		}
+	}
+	if separatorStr != "," {
+		conflict := getConflict(givenFlag{jsonFlag, jsonOut}, givenFlag{promFlag, promOut},
+			givenFlag{tsvFlag, tsvOut}, givenFlag{mdFlag, mdOut},
+			givenFlag{htmlFlag, htmlOut}, givenFlag{templateFlag, templateStr != ""})
+		if conflict != "" {
+			// only CSV has fields separated by a character that can be chosen
+			fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+				os.Args[0], separatorFlag, conflict)
+			flag.Usage()
+			os.Exit(getUsageExit())
+		}
+	}
+	if allIPs {
+		connectedIP = true
+	}
+	if fullTime && (timeFormat == "date") {
+		timeFormat = "datetime"
+	}
+	var err error
+	expiresLayout, err = getLayout(timeFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	minTLS, err = getTLSVersion(minTLSStr)
+	if err == nil {
+		maxTLS, err = getTLSVersion(maxTLSStr)
+	}
+	if (minTLS == 0) && (maxTLS != 0) && (maxTLS < tls.VersionTLS12) {
+		minTLS = tls.VersionTLS10 // else below the default MinVersion, so no versions to offer
+	}
+	if (err == nil) && (minTLS != 0) && (maxTLS != 0) && (minTLS > maxTLS) {
+		err = fmt.Errorf("%s: flag -%s is above flag -%s", os.Args[0], minTLSFlag, maxTLSFlag)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	separator, err = getSeparator(separatorStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	exitOn, err = getExitOn(exitOnStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if failFast && (exitOn[expiringCause] == false) {
+		fmt.Fprintf(os.Stderr, "%s: flag -%s needs %s in flag -%s\n",
+			os.Args[0], failFastFlag, expiringCause, exitOnFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	switch {
+	case (socks5Str != "") && (proxyStr != ""):
+		fmt.Fprintf(os.Stderr, "%s: flags -%s and -%s cannot both be used\n",
+			os.Args[0], proxyFlag, socks5Flag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	case socks5Str != "":
+		proxy, err = getSOCKS5(socks5Str)
+	case proxyStr != "":
+		proxy, err = getProxy(proxyStr)
+	case allIPs == false:
+		// the environment is not checked given -all-ips, which connects directly
+		envProxy = getEnvProxyFunc()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if allIPs && (proxy != nil) {
+		// the proxy, not lscerts, chooses which IP address to connect to
+		fmt.Fprintf(os.Stderr, "%s: flag -%s cannot be used with a proxy\n", os.Args[0], allIPsFlag)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	source, err = getSource(sourceStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	detailTemplate, err = getTemplate(templateStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(getUsageExit())
+	}
+	if stateName != "" {
+		previousCerts, err = readState(stateName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(fileExit)
+		}
+	}
+	if dbName != "" {
+		db, err = openDB(dbName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(fileExit)
+		}
+	}
+	if outputName != "" {
+		output, err = os.Create(outputName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+			os.Exit(fileExit)
+		}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+			os.Exit(fileExit)
+		}
+		rootCAs = x509.NewCertPool()
+		if rootCAs.AppendCertsFromPEM(pem) == false {
+			fmt.Fprintf(os.Stderr, "%s %q: no valid certificates in CA file\n", os.Args[0], caFile)
+			os.Exit(fileExit)
+		}
+	}
+	if certFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+			os.Exit(fileExit)
+		}
+		clientCerts = []tls.Certificate{clientCert}
+	}
+	if listURL != "" {
+		list, err := getList(listURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(fileExit)
+		}
+		inputs = append(inputs, list)
+	}
+	if (flag.NArg() == 0) && (listURL == "") {
+		inputs = []io.Reader{os.Stdin}
+		return
+	}
+	for _, arg := range flag.Args() {
+		if arg == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		input, err := os.Open(arg)
+		switch {
+		case (err != nil) && errors.Is(err, fs.ErrNotExist) && strings.Contains(arg, "://"):
+			// arg is a URL not a file
+			inputs = append(inputs, strings.NewReader(arg))
+		case err != nil:
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		default:
+			inputs = append(inputs, input)
+		}
+	}
+	if len(inputs) == 0 {
+		os.Exit(fileExit)
+	}
+}
+
+// GetTLSVersion parses str as a TLS version, such as 1.2 or TLS1.2,
+// returning version == the version and err == nil.
+// If str is "", getTLSVersion returns version == 0, for the default, and err == nil.
+// If str is not a TLS version in tlsVersions, getTLSVersion returns version == 0 and err != nil.
+func getTLSVersion(str string) (version uint16, err error) {
+	if str == "" {
+		return 0, nil
+	}
+	for version, name := range tlsVersions {
+		if (strings.EqualFold(str, name)) || (str == strings.TrimPrefix(name, "TLS")) {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf("%s %q: TLS version not 1.0, 1.1, 1.2 or 1.3", os.Args[0], str)
+}
+
+// GetSeparator parses str as a character to separate CSV fields,
+// returning separator == the character and err == nil.
+// If str is not one character that can separate CSV fields, as a quote or line break cannot,
+// getSeparator returns separator == 0 and err != nil.
+func getSeparator(str string) (separator rune, err error) {
+	separator, size := utf8.DecodeRuneInString(str)
+	if (size == 0) || (size != len(str)) || (separator == utf8.RuneError) ||
+		strings.ContainsRune("\"\r\n", separator) {
+		return 0, fmt.Errorf("%s %q: separator not one character, other than a quote or line break",
+			os.Args[0], str)
+	}
+	return separator, nil
+}
+
+// GetExitOn parses str, causes separated by commas or neverCause on its own,
+// returning causes == the causes, each with a value of true, and err == nil.
+// If str has a cause that is unknown, repeated or neverCause with another,
+// getExitOn returns causes == nil and err != nil.
+func getExitOn(str string) (causes map[string]bool, err error) {
+	causes = map[string]bool{}
+	if str == neverCause {
+		return causes, nil
+	}
+	for _, cause := range strings.Split(str, ",") {
+		cause = strings.TrimSpace(cause)
+		switch {
+		case (cause != parseErrorCause) && (cause != fetchErrorCause) && (cause != expiringCause):
+			return nil, fmt.Errorf("%s %q: cause not %s, %s, %s or %s on its own",
+				os.Args[0], cause, parseErrorCause, fetchErrorCause, expiringCause, neverCause)
+		case causes[cause]:
+			return nil, fmt.Errorf("%s %q: cause repeated", os.Args[0], cause)
+		}
+		causes[cause] = true
+	}
+	return causes, nil
+}
+
+// GetHostPort parses str as a URL with a scheme in defaultPorts, such as HTTPS,
+// or as a host name with an optional port, such as example.com:8443,
+// for a URL with scheme defaultScheme, HTTPS by default,
+// returning scheme == the URL's scheme, hostPort == "<hostName>:<portNumber>",
+// with an internationalized host name in punycode, and err == nil.
+// If upgrade == true, an http URL is parsed as https, on port 443 unless another port
+// than 80 is given, after writing a warning to standard error.
+// If failed to parse a URL, getHostPort returns scheme == "", hostPort == "" and err != nil.
+func getHostPort(str string) (scheme, hostPort string, err error) {
+	if raw {
+		return getRawHostPort(str)
+	}
+	urlStr := str
+	if strings.Contains(str, "://") == false {
+		// without a scheme, url.Parse would take host "example.com" as a path
+		// and "example.com:8443" as scheme "example.com"
+		urlStr = defaultScheme + "://" + str
+	}
+	url, err := url.Parse(urlStr)
+	if err != nil {
+		return "", "", fmt.Errorf("%s %w", os.Args[0], err)
+	}
+	if url.Hostname() == "" {
+		// such as ":8443", which would otherwise connect to this host
+		return "", "", fmt.Errorf("%s %q: no host", os.Args[0], str)
+	}
+	port := url.Port()
+	if upgrade && (url.Scheme == "http") {
+		fmt.Fprintf(os.Stderr, "%s %q: url scheme http upgraded to https\n", os.Args[0], str)
+		url.Scheme = "https"
+		if port == "80" {
+			port = ""
+		}
+	}
+	defaultPort, ok := defaultPorts[url.Scheme]
+	if ok == false {
+		return "", "", errors.New(fmt.Sprintf(
+			"%s %q: url scheme not https or smtp", os.Args[0], str))
+	}
+
+	if port == "" {
+		port = defaultPort
+	}
+	if isPort(port) == false {
+		return "", "", fmt.Errorf("%s %q: port not a number from 1 to 65535", os.Args[0], str)
+	}
+	host, err := getASCIIHost(url.Hostname())
+	if err != nil {
+		return "", "", fmt.Errorf("%s %q: %w", os.Args[0], str, err)
+	}
+	// Hostname removes brackets from IPv6 literals, which JoinHostPort replaces
+	hostPort = net.JoinHostPort(host, port)
+	return url.Scheme, hostPort, nil
+}
+
+// GetASCIIHost returns host, a host name or IP address, with any Unicode labels
+// of an internationalized domain name converted to punycode (IDNA), as DNS and SNI need,
+// such as xn--r8jz45g.jp for 例え.jp, and err == nil.
+// If host is not a valid internationalized domain name, getASCIIHost returns ascii == "" and err != nil.
+func getASCIIHost(host string) (ascii string, err error) {
+	for _, r := range host {
+		if r > unicode.MaxASCII {
+			return idna.Lookup.ToASCII(host)
+		}
+	}
+	return host, nil // not converted, as IDNA rejects some ASCII names that DNS allows
+}
+
+// GetRawHostPort parses str as "<hostName>:<portNumber>", of a TLS service without a URL,
+// returning scheme == rawScheme, hostPort == str and err == nil.
+// If failed to parse str, getRawHostPort returns scheme == "", hostPort == "" and err != nil.
+func getRawHostPort(str string) (scheme, hostPort string, err error) {
+	host, port, err := net.SplitHostPort(str)
+	switch {
+	case err != nil:
+		return "", "", fmt.Errorf("%s %q: not host:port", os.Args[0], str)
+	case host == "":
+		return "", "", fmt.Errorf("%s %q: no host", os.Args[0], str)
+	case isPort(port) == false:
+		return "", "", fmt.Errorf("%s %q: port not a number from 1 to 65535", os.Args[0], str)
+	}
+	host, err = getASCIIHost(host)
+	if err != nil {
+		return "", "", fmt.Errorf("%s %q: %w", os.Args[0], str, err)
+	}
+	return rawScheme, net.JoinHostPort(host, port), nil
+}
+
+// IsPort reports whether port is a TCP port number, from 1 to 65535.
+func isPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return (err == nil) && (1 <= number) && (number <= 65535)
+}
 
-// if noHeader == true then do not write header for certificate details
-const noHeaderFlag = "n"
-const noHeaderText = "do not write header for certificate details"
+// FetchCert fetches and validates certificates from URL <scheme>://<hostPort>
+// for serverName, which is sent in the TLS handshake (SNI) and validated against the leaf,
+// waiting up to timeout, returning state == the state of the TLS connection, including
+// PeerCertificates == valid certificates, leaf first,
+// info == about the connection and err == nil.
+// If getProxyFor(hostPort) != nil, the certificates are fetched through a tunnel to that proxy,
+// whose IP address is info.remoteIP.
+// If scheme is in startTLS, the connection is upgraded to TLS before the handshake.
+// If insecure == true, the certificates are not validated.
+// If fetching fails with a transient error, such as a timeout,
+// fetchCert tries again up to retries times, waiting longer between each try.
+// If failed to fetch or validate the certificates, or ctx is cancelled,
+// fetchCert returns state == empty, info == empty and err != nil.
+func fetchCert(ctx context.Context, scheme, hostPort, serverName string) (state tls.ConnectionState,
+	info connInfo, err error) {
+	const firstWait = 250 * time.Millisecond
+	for try := 0; ; try++ {
+		state, info, err = fetchCertOnce(ctx, scheme, hostPort, serverName)
+		if (err == nil) || (try == retries) || (isTransient(err) == false) {
+			return state, info, err
+		}
+		select {
+		case <-ctx.Done():
+			return state, info, err
+		case <-time.After(firstWait << try):
+		}
+	}
+}
 
-var noHeader bool
+// ConnInfo is about the connection on which fetchCert fetched certificates.
+type connInfo struct {
+	remoteIP  string        // IP address connected to
+	connect   time.Duration // taken to connect, including through any proxy
+	handshake time.Duration // taken for the TLS handshake, including any STARTTLS
+}
 
-// Init processes command line flags and arguments setting input and noHeader.
-// If a flag is undefined, help was requested, there are too many arguments or
-// the file argument cannot be read, init will exit the program.
-func init() {
-	const helpFlag = "h"
-	const helpText = "write this help text then exit"
-	var help bool
-	flag.BoolVar(&help, helpFlag, false, helpText)
-	flag.BoolVar(&noHeader, noHeaderFlag, false, noHeaderText)
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "\nUsage: %s [-%s][-%s] [file]\n",
-			os.Args[0], helpFlag, noHeaderFlag)
-		fmt.Fprintln(os.Stderr, `
-Lscerts lists certificates in the order they will expire.
-It reads a list of HTTPS URLs from file or standard input, one URL per line.
-For each URL, it writes details of the leaf certificate or an error.
-			`)
-		flag.PrintDefaults()
-		fmt.Fprintln(os.Stderr)
+// FetchCertOnce is fetchCert without retries.
+func fetchCertOnce(ctx context.Context, scheme, hostPort, serverName string) (state tls.ConnectionState,
+	info connInfo, err error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	connectDeadline := deadline
+	if connectTimeout > 0 {
+		connectDeadline = start.Add(connectTimeout)
 	}
-	flag.Parse()
-
-	if help {
-		flag.Usage()
-		os.Exit(0)
+	conn, err := dial(ctx, hostPort, connectDeadline)
+	if err != nil {
+		// failed to connect to hostPort in timeout
+		return state, info, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, explainDialError(err))
+	}
+	defer conn.Close()
+	connected := time.Now()
+	handshakeDeadline := deadline
+	switch {
+	case handshakeTimeout > 0:
+		handshakeDeadline = connected.Add(handshakeTimeout)
+	case connectTimeout > 0:
+		// connecting may have taken longer than timeout, which is then for the handshake
+		handshakeDeadline = connected.Add(timeout)
 	}
-	switch flag.NArg() {
-	case 0:
-		input = os.Stdin
-	case 1:
-		var err error
-		input, err = os.Open(flag.Arg(0))
+	ctx, cancel := context.WithDeadline(ctx, handshakeDeadline)
+	defer cancel()
+	conn.SetDeadline(handshakeDeadline) // for STARTTLS, which does not take ctx
+
+	upgrade, ok := startTLS[scheme]
+	if ok {
+		err = upgrade(conn)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
-			os.Exit(3)
+			return state, info, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, err)
 		}
+	}
+	config := &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            rootCAs,
+		Certificates:       clientCerts,
+		InsecureSkipVerify: insecure,
+		MinVersion:         minTLS,
+		MaxVersion:         maxTLS,
+	}
+	if alpn && (scheme == "https") {
+		config.NextProtos = alpnProtocols
+	}
+	tlsConn := tls.Client(conn, config)
+	err = tlsConn.HandshakeContext(ctx)
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		err = fmt.Errorf("certificate not valid: %w",
+			explainVerifyError(serverName, verifyErr.UnverifiedCertificates, err))
+		return state, info, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, err)
+	}
+	if err != nil {
+		// failed to validate certificates in timeout
+		return state, info, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, explainHandshakeError(err))
+	}
+
+	info.remoteIP, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	info.connect = connected.Sub(start)
+	info.handshake = time.Since(connected)
+	return tlsConn.ConnectionState(), info, nil
+}
+
+// IsTransient reports whether err, from fetchCertOnce, might not happen if tried again:
+// a timeout, a temporary DNS failure or the connection being reset.
+// Failures to validate certificates are not transient.
+func isTransient(err error) bool {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
 	default:
-		flag.Usage()
-		os.Exit(2)
+		return errors.Is(err, syscall.ECONNRESET)
 	}
 }
 
-// GetHostPort parses str as an HTTPS URL
-// returning hostPort == "<hostName>:<portNumber>" and err == nil.
-// If failed to parse a URL, getHostPort returns hostPort == "" and err != nil.
-func getHostPort(str string) (hostPort string, err error) {
-	url, err := url.Parse(str)
+// ExplainDialError returns err, from failing to connect, preceded by why:
+// the DNS lookup of the host failed, as for a host that no longer exists,
+// the connection was refused, as for a service that is down,
+// the host was unreachable or connecting timed out.
+func explainDialError(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
 	switch {
-	case err != nil:
-		return "", fmt.Errorf("%s %w", os.Args[0], err)
-	case url.Scheme != "https":
-		return "", errors.New(fmt.Sprintf(
-			"%s %q: url scheme not https", os.Args[0], str))
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("DNS lookup failed: %w", err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("connection refused: %w", err)
+	case errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH):
+		return fmt.Errorf("host unreachable: %w", err)
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return fmt.Errorf("connect timed out: %w", err)
 	}
+	return err
+}
+
+// ExplainHandshakeError returns err, from a failed TLS handshake, preceded by
+// why it failed if the peer reset or closed the connection, it timed out
+// or there was no TLS version in common,
+// which otherwise show as read errors or context deadline exceeded.
+func explainHandshakeError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return fmt.Errorf("handshake reset by peer: %w", err)
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("handshake closed by peer: %w", err)
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return fmt.Errorf("handshake timed out: %w", err)
+	case strings.Contains(err.Error(), "protocol version"):
+		// from the server's protocol_version alert, or the client if the server chose another version
+		return fmt.Errorf("handshake failed, no TLS version in common from %s to %s: %w",
+			tlsVersionName(minTLS, tls.VersionTLS12), tlsVersionName(maxTLS, tls.VersionTLS13), err)
+	}
+	return err
+}
 
-	hostPort = url.Host
-	if url.Port() == "" {
-		const httpsPort = 443
-		hostPort = fmt.Sprintf("%s:%d", hostPort, httpsPort)
+// TLSVersionName returns how version, a TLS version, is written
+// or how defaultVersion is if version == 0.
+func tlsVersionName(version, defaultVersion uint16) (name string) {
+	if version == 0 {
+		version = defaultVersion
 	}
-	return hostPort, nil
+	return tlsVersions[version]
 }
 
-// FetchCert fetches and validates certificates from URL https://<hostPort>
-// returning cert == valid leaf certificate and err == nil.
-// If failed to fetch or validate the certificates,
-// fetchCert returns cert == nil and err != nil.
-func fetchCert(hostPort string) (cert *x509.Certificate, err error) {
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second},
-		"tcp", hostPort, nil)
+// VerifyCerts validates certs, a chain with the leaf certificate first,
+// for serverName returning err == nil if they are valid.
+// This is the validation fetchCert skips if insecure == true.
+func verifyCerts(serverName string, certs []*x509.Certificate) (err error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         rootCAs,
+	})
 	if err != nil {
-		// failed to connect to hostPort in timeout
-		// or validate certificates
-		return nil, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, err)
+		return explainVerifyError(serverName, certs, err)
 	}
-	defer conn.Close()
+	return nil
+}
+
+// ExplainVerifyError returns err, from validating certs for serverName,
+// preceded by which certificate in certs, a chain with the leaf certificate first,
+// caused it and why: expired, not yet valid, not valid for serverName or not trusted.
+// If no certificate is found to cause err, explainVerifyError returns err.
+func explainVerifyError(serverName string, certs []*x509.Certificate, err error) error {
+	now := time.Now()
+	for i, cert := range certs {
+		switch {
+		case now.After(cert.NotAfter):
+			return fmt.Errorf("%s %q expired %s: %w",
+				getPosition(certs, i), cert.Subject, formatExpires(cert.NotAfter), err)
+		case now.Before(cert.NotBefore):
+			return fmt.Errorf("%s %q not valid until %s: %w",
+				getPosition(certs, i), cert.Subject, formatExpires(cert.NotBefore), err)
+		}
+	}
+
+	var hostErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	switch {
+	case errors.As(err, &hostErr):
+		return fmt.Errorf("leaf %q not valid for %q: %w", certs[0].Subject, serverName, err)
+	case errors.As(err, &authorityErr) && (authorityErr.Cert != nil):
+		for i, cert := range certs {
+			if cert.Equal(authorityErr.Cert) {
+				return fmt.Errorf("%s %q issued by untrusted %q: %w",
+					getPosition(certs, i), cert.Subject, cert.Issuer, err)
+			}
+		}
+	}
+	return err
+}
+
+// GetSerialNumber returns the serial number of cert in decimal,
+// or if hexSerial == true in uppercase hexadecimal bytes separated by colons,
+// shortened by shortenSerial.
+func getSerialNumber(cert *x509.Certificate) (serial string) {
+	if hexSerial == false {
+		return shortenSerial(cert.SerialNumber.String())
+	}
+	serialBytes := cert.SerialNumber.Bytes() // of the absolute value, nil for zero
+	if len(serialBytes) == 0 {
+		serialBytes = []byte{0}
+	}
+	serial = getHexBytes(serialBytes)
+	if cert.SerialNumber.Sign() < 0 {
+		// only get here for invalid certificates, as RFC 5280 requires positive serial numbers
+		serial = "-" + serial
+	}
+	return shortenSerial(serial)
+}
+
+// ShortenSerial returns serial, if serialMax == 0 or it is no longer than serialMax characters,
+// otherwise its start and end joined by "..." to be serialMax characters long.
+func shortenSerial(serial string) (shortened string) {
+	const ellipsis = "..."
+	if (serialMax == 0) || (len(serial) <= serialMax) {
+		return serial // serial is ASCII, so its length is in characters
+	}
+	if serialMax <= len(ellipsis) {
+		return serial[:serialMax]
+	}
+	kept := serialMax - len(ellipsis)
+	return serial[:kept-kept/2] + ellipsis + serial[len(serial)-kept/2:]
+}
+
+// GetHexBytes returns bs in uppercase hexadecimal bytes separated by colons, such as 0A:1B:2C.
+func getHexBytes(bs []byte) (hexBytes string) {
+	hexes := make([]string, len(bs))
+	for i, b := range bs {
+		hexes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexes, ":")
+}
+
+// IsSelfSigned reports whether cert is issued by and signed with its own key,
+// as a root CA is and a leaf certificate may be, such as in development.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) == false {
+		return false
+	}
+	// not CheckSignatureFrom, which also requires cert to be a CA, as a self-signed leaf is not
+	err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	var insecure x509.InsecureAlgorithmError
+	// an algorithm such as SHA-1 is not trusted but cert was still signed with its own key
+	return (err == nil) || errors.As(err, &insecure)
+}
+
+// IsRoot reports whether cert is a root CA certificate: a self-signed CA.
+func isRoot(cert *x509.Certificate) bool {
+	return cert.IsCA && isSelfSigned(cert)
+}
+
+// IsCertSelector returns true if selector is leaf, intermediate, root
+// or a non-negative integer, as certSelector may be.
+func isCertSelector(selector string) bool {
+	switch selector {
+	case "leaf", "intermediate", "root":
+		return true
+	}
+	index, err := strconv.Atoi(selector)
+	return (err == nil) && (index >= 0)
+}
+
+// SelectCert returns cert == the certificate selected by certSelector in state
+// and err == nil. A root certificate is selected from the first verified chain,
+// as URLs need not send their root, or if not verified, as when insecure == true,
+// the last certificate fetched if self-signed.
+// If there is no such certificate, selectCert returns cert == nil and err != nil.
+func selectCert(state tls.ConnectionState) (cert *x509.Certificate, err error) {
+	certs := state.PeerCertificates
+	index := 0
+	switch certSelector {
+	case "leaf":
+	case "intermediate":
+		index = 1
+	case "root":
+		if len(state.VerifiedChains) > 0 {
+			certs = state.VerifiedChains[0]
+		}
+		index = len(certs) - 1
+		if (index < 1) || (isRoot(certs[index]) == false) {
+			return nil, errors.New("no root certificate in chain")
+		}
+	default:
+		index, _ = strconv.Atoi(certSelector) // checked by isCertSelector
+	}
+	if index >= len(certs) {
+		return nil, fmt.Errorf("no certificate %d in chain of %d certificates", index, len(certs))
+	}
+	return certs[index], nil
+}
+
+// GetPosition returns the position of the certificate at index i in certs,
+// a chain with the leaf certificate first:
+// leaf, intermediate or root (a self-signed CA).
+func getPosition(certs []*x509.Certificate, i int) (position string) {
+	cert := certs[i]
+	switch {
+	case i == 0:
+		return "leaf"
+	case isRoot(cert):
+		return "root"
+	default:
+		return "intermediate"
+	}
+}
 
-	const leafCertI = 0
-	cert = conn.ConnectionState().PeerCertificates[leafCertI]
-	return cert, nil
+// GetPublicKey returns the algorithm and size of cert's public key,
+// for example "RSA 2048" or "ECDSA P-256".
+// If the size is not known, or as for Ed25519 keys is always the same, getPublicKey returns
+// just the algorithm, such as "Ed25519".
+func getPublicKey(cert *x509.Certificate) (publicKey string) {
+	algorithm := cert.PublicKeyAlgorithm.String()
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("%s %d", algorithm, key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("%s %s", algorithm, key.Curve.Params().Name)
+	default:
+		return algorithm
+	}
 }
 
 // GetToExpiry returns how long from now to expiry
-// rounded down to an integer number of hours, weeks or years.
+// rounded down to an integer number of hours, days, weeks or calendar years,
+// or if expiry has passed "expired", or if inDays == true the negative number of days since.
 func getToExpiry(expiry time.Time) (toExpiry string) {
+	if time.Now().After(expiry) {
+		// only get here if insecure == true,
+		// otherwise expired certificates are invalid so listed as errors
+		if inDays {
+			// rounded down, so a certificate expired in the last day has -1
+			const hoursPerDay = 24
+			days := int(math.Floor(time.Until(expiry).Hours() / hoursPerDay))
+			return strconv.Itoa(days)
+		}
+		return "expired"
+	}
+	return roundDown(time.Now(), expiry)
+}
+
+// GetRemaining returns the percentage, rounded down, of cert's lifetime
+// from when it is valid to expiry that remains: 0 if it has expired or 100 if not yet valid.
+func getRemaining(cert *x509.Certificate) (remaining int) {
+	total := cert.NotAfter.Sub(cert.NotBefore)
+	left := time.Until(cert.NotAfter)
+	switch {
+	case left <= 0:
+		return 0
+	case left >= total:
+		return 100
+	}
+	return int(100 * left / total)
+}
+
+// GetToValid returns how long from now until a certificate valid from notBefore is valid,
+// rounded down as by getToExpiry, or "" if the certificate is already valid.
+func getToValid(notBefore time.Time) (toValid string) {
+	if time.Now().After(notBefore) {
+		return ""
+	}
+	// only get here if insecure == true,
+	// otherwise certificates not yet valid are invalid so listed as errors
+	return roundDown(time.Now(), notBefore)
+}
+
+// RoundDown returns how long from now until then, which is not before now,
+// rounded down to an integer number of hours, days, weeks or calendar years,
+// or just days, without a unit, if inDays == true.
+func roundDown(now, then time.Time) (rounded string) {
 	const hoursPerDay = 24
 	const hoursPerWeek = hoursPerDay * 7
-	const hoursPerYear = hoursPerWeek * 52
-	hours := int64(time.Until(expiry).Hours())
+	hours := int64(then.Sub(now).Hours())
 	switch {
-	case hours < 0:
-		// cannot get here,
-		// expired certificates are invalid so listed as errors
-		toExpiry = "expired"
+	case inDays:
+		days := int(hours / hoursPerDay)
+		rounded = strconv.Itoa(days)
 	case hours < 1:
-		toExpiry = "<1h"
+		rounded = "<1h"
 	case hours <= hoursPerDay:
-		toExpiry = fmt.Sprintf("%dh", hours)
+		rounded = fmt.Sprintf("%dh", hours)
 	case hours <= hoursPerWeek:
 		days := int(hours / hoursPerDay)
-		toExpiry = fmt.Sprintf("%dd", days)
-	case hours <= hoursPerYear:
+		rounded = fmt.Sprintf("%dd", days)
+	case then.Before(now.AddDate(1, 0, 0)):
 		weeks := int(hours / hoursPerWeek)
-		toExpiry = fmt.Sprintf("%dw", weeks)
+		rounded = fmt.Sprintf("%dw", weeks)
 	default:
-		years := int(hours / hoursPerYear)
-		toExpiry = fmt.Sprintf("%dy", years)
+		// count years by calendar, so leap years are a day longer
+		years := 1
+		for now.AddDate(years+1, 0, 0).After(then) == false {
+			years++
+		}
+		rounded = fmt.Sprintf("%dy", years)
 	}
-	return toExpiry
+	return rounded
 }
 
-// Main reads HTTPS URLs from input, one URL per line ignoring blank or comment lines,
-// writing details of each URL's leaf certificate to standard output,
-// sorted by expiry date ascending.
-// If main fails to read input, it will write the error to standard error then exit the program.
-// Errors from failures to parse HTTPS URLs, fetch or validate certificates are
-// written to standard error before any certificate details.
-func main() {
-	var err error
-	details := []string{}
+// StripInlineComment returns line without any comment at its end,
+// starting with comment after white space, and the white space before it.
+// A URL cannot contain white space, so comment in a URL, such as a "#" fragment, is kept.
+func stripInlineComment(line string) string {
+	start := 0
+	for {
+		i := strings.Index(line[start:], comment)
+		if i < 0 {
+			return line
+		}
+		i += start
+		if (i > 0) && strings.ContainsAny(line[i-1:i], " \t") {
+			return strings.TrimSpace(line[:i])
+		}
+		start = i + len(comment)
+	}
+}
+
+// SkipBOM returns a reader of input without the UTF-8 byte order mark it starts with, if any,
+// as Windows editors write. Peek errors are left for the returned reader to return.
+func skipBOM(input io.Reader) io.Reader {
+	const bom = "\uFEFF"
+	reader := bufio.NewReader(input)
+	start, _ := reader.Peek(len(bom))
+	if string(start) == bom {
+		reader.Discard(len(bom))
+	}
+	return reader
+}
+
+// CheckLines parses each of lines as main does, without fetching certificates,
+// writing an error to standard error for each line that fails,
+// returning invalid == how many failed.
+func checkLines(lines []string) (invalid int) {
+	for _, line := range lines {
+		urlStr, serverName, _ := strings.Cut(line, serverNameSep)
+		_, _, err := getHostPort(urlStr)
+		if err == nil {
+			_, err = getASCIIHost(serverName)
+			if err != nil {
+				err = fmt.Errorf("%s %q: server name: %w", os.Args[0], line, err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			invalid++
+		}
+	}
+	return invalid
+}
+
+// ReadLines reads input returning lines == the lines that are not blank or comment,
+// with leading and trailing white space, including the carriage returns of CRLF line ends,
+// and inline comments removed and err == nil.
+// If failed to read input, readLines returns lines == nil and err != nil.
+func readLines(input io.Reader) (lines []string, err error) {
 	scanner := bufio.NewScanner(input)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if (line == "") || (line[0] == comment) {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || ((comment != "") && strings.HasPrefix(line, comment)) {
 			continue // ignore blank or comment line
 		}
-		hostPort, err := getHostPort(line)
+		if comment != "" {
+			line = stripInlineComment(line)
+		}
+		lines = append(lines, line)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", os.Args[0], err)
+	}
+	return lines, nil
+}
+
+// ReadJSONURLs reads input, a JSON array of objects with field url,
+// returning urls == the urls that are not blank, with leading and trailing white space removed,
+// and err == nil. Other fields of the objects are ignored.
+// If failed to read or decode input, readJSONURLs returns urls == nil and err != nil.
+func readJSONURLs(input io.Reader) (urls []string, err error) {
+	objects := []struct {
+		URL string `json:"url"`
+	}{}
+	err = json.NewDecoder(input).Decode(&objects)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", os.Args[0], err)
+	}
+	for _, object := range objects {
+		url := strings.TrimSpace(object.URL)
+		if url == "" {
+			continue // ignore object without a URL
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// Main reads HTTPS URLs from inputs in order, one URL per line ignoring blank or comment lines,
+// or from a JSON array of objects if inputFormat == jsonFormat,
+// and URLs for the same scheme, host and port as an earlier URL,
+// fetching certificates from up to parallel URLs at the same time,
+// writing details of each URL's leaf certificate,
+// or every certificate in its chain if chain == true, to output,
+// sorted by sortField, expiry date by default, ascending or descending if reverse == true,
+// or unsorted as each URL is fetched if stream == true.
+// If within > 0, only details of certificates that expire within within are written,
+// and if weakOnly == true, only those signed with a weak algorithm.
+// The details are written as CSV, or as a JSON array if jsonOut == true.
+// If main fails to read input, it will write the error to standard error then exit the program.
+// If warn > 0 and any certificate expires within warn, written or not, and exitOn has expiringCause,
+// main will exit the program with expiringExit after writing the details.
+// Otherwise if any URL failed to parse or fetch, for a cause in exitOn,
+// main will exit the program with failedExit, immediately if strict == true.
+// Errors from failures to parse HTTPS URLs, fetch or validate certificates are
+// written to standard error before any certificate details,
+// as are warnings for leaf certificates not valid for the server name
+// or that outlive an intermediate certificate.
+func main() {
+	parseFlags()
+	lines := []string{}
+	for _, input := range inputs {
+		read := readLines
+		if inputFormat == jsonFormat {
+			read = readJSONURLs
+		}
+		inputLines, err := read(skipBOM(input))
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			os.Exit(ioExit)
+		}
+		lines = append(lines, inputLines...)
+	}
+	if requireInput && (len(lines) == 0) {
+		fmt.Fprintf(os.Stderr, "%s: no URLs in input\n", os.Args[0])
+		os.Exit(fileExit)
+	}
+	if nagios {
+		status, line := checkNagios(lines)
+		fmt.Println(line)
+		os.Exit(status)
+	}
+	if checkOnly {
+		invalid := checkLines(lines)
+		fmt.Fprintf(output, "valid %d, invalid %d\n", len(lines)-invalid, invalid)
+		if (invalid > 0) && exitOn[parseErrorCause] {
+			os.Exit(failedExit)
+		}
+		os.Exit(0)
+	}
+
+	run := time.Now() // saved with details if dbName != ""
+	suppressed := 0   // errors for URLs not written as quiet == true
+	writeURLError := func(err error) {
+		if quiet {
+			suppressed++
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+	failures := 0
+	failedExiting := false // a failure has a cause in exitOn
+	urlErrs := []urlError{}
+	fail := func(cause, url string, err error) {
+		if errorsOut || promOut {
+			urlErrs = append(urlErrs, newURLError(url, err))
+		}
+		if errorsOut == false {
+			writeURLError(err)
+		}
+		failures++
+		failedExiting = failedExiting || exitOn[cause]
+		if strict && exitOn[cause] {
+			os.Exit(failedExit)
+		}
+	}
+
+	fetches := []*urlFetch{}
+	fetched := map[string]bool{} // scheme, hostPort and serverName of URLs to fetch
+	for _, line := range lines {
+		urlStr, serverName, _ := strings.Cut(line, serverNameSep)
+		scheme, hostPort, err := getHostPort(urlStr)
+		if err != nil {
+			fetches = append(fetches, &urlFetch{urlStr: urlStr, err: err, parseErr: true})
 			continue
 		}
-		url := line
-		cert, err := fetchCert(hostPort)
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(hostPort)
+		}
+		serverName, err = getASCIIHost(serverName)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			err = fmt.Errorf("%s %q: server name: %w", os.Args[0], line, err)
+			fetches = append(fetches, &urlFetch{urlStr: urlStr, err: err, parseErr: true})
 			continue
 		}
+		hostPorts := []string{hostPort}
+		if allIPs {
+			hostPorts, err = getIPHostPorts(hostPort)
+			if err != nil {
+				fetches = append(fetches, &urlFetch{urlStr: urlStr, err: err})
+				continue
+			}
+		}
+		for _, hostPort := range hostPorts {
+			key := strings.ToLower(scheme + "://" + hostPort + serverNameSep + serverName)
+			if fetched[key] {
+				continue // ignore URL for the same host, port and server name as an earlier URL
+			}
+			fetched[key] = true
+			fetches = append(fetches, &urlFetch{urlStr: urlStr, scheme: scheme,
+				hostPort: hostPort, serverName: serverName})
+		}
+	}
+	onFetched := func(f *urlFetch) {}
+	if failFast {
+		warnTime := time.Now().Add(warn)
+		onFetched = func(f *urlFetch) {
+			if f.err != nil {
+				return
+			}
+			certs := f.state.PeerCertificates
+			if chain == false {
+				cert, err := selectCert(f.state)
+				if err != nil {
+					return // failed in main loop below
+				}
+				certs = []*x509.Certificate{cert}
+			}
+			for _, cert := range certs {
+				if cert.NotAfter.Before(warnTime) {
+					writeDetails([]certDetail{newCertDetail(f.url, cert)}, nil)
+					os.Exit(expiringExit)
+				}
+			}
+		}
+	}
+	checked := len(fetches)
+	interrupted := 0 // URLs not fetched, as interrupted
+	details := []certDetail{}
+	issuersBySerial := map[string]map[string]string{} // URL of each issuer of each serial number
+	// process appends the details of the certificates fetched by f to details,
+	// or fails f, writing any warnings to standard error
+	process := func(f *urlFetch) {
+		if errors.Is(f.err, errNotPublic) {
+			fmt.Fprintln(os.Stderr, f.err)
+			checked--
+			return // skip URL, which is not a failure
+		}
+		if errors.Is(f.err, errInterrupted) {
+			checked--
+			interrupted++
+			return // skip URL, which is not a failure
+		}
+		if (f.err != nil) && f.parseErr {
+			fail(parseErrorCause, f.urlStr, f.err)
+			return
+		}
+		if f.err != nil {
+			fail(fetchErrorCause, f.urlStr, f.err)
+			return
+		}
+		if verbose {
+			f.writeDiagnostics()
+		}
+		certs := f.state.PeerCertificates
+		written := certs // certificates to write details for
+		if chain == false {
+			cert, err := selectCert(f.state)
+			if err != nil {
+				fail(fetchErrorCause, f.urlStr, fmt.Errorf("%s %q: %w", os.Args[0], f.hostPort, err))
+				return
+			}
+			written = []*x509.Certificate{cert}
+		}
 
-		// cert is valid leaf certificate for url fetched from hostPort
-		expiryTime := cert.NotAfter
-		toExpiry := getToExpiry(expiryTime)
-		fields := []string{expiryTime.Format(time.DateOnly), toExpiry, url,
-			cert.SerialNumber.String(), cert.Issuer.CommonName}
-		record := strings.Join(fields, ",")
-		details = append(details, record)
+		// certs are valid certificates for f.url fetched from f.hostPort,
+		// unless insecure == true when notValid says why they are not
+		err := certs[0].VerifyHostname(f.serverName)
+		if err != nil {
+			// only get here if insecure == true, as the handshake checks serverName,
+			// when the reason in notValid might be another
+			fmt.Fprintf(os.Stderr, "%s %q: warning: %v\n", os.Args[0], f.hostPort, err)
+		}
+		warnShortIntermediates(f.hostPort, f.state)
+		warnWeakSignatures(f.hostPort, f.state)
+		notValid := ""
+		if insecure {
+			err = verifyCerts(f.serverName, certs)
+			if err != nil {
+				notValid = err.Error()
+			}
+		}
+		if f.ocspErr != nil {
+			writeURLError(f.ocspErr)
+		}
+		if f.ctErr != nil {
+			writeURLError(f.ctErr)
+		}
+		const leafCertI = 0
+		for i, cert := range written { // written == certs if chain == true
+			if (renewBelow > 0) && (getRemaining(cert) < renewBelow) {
+				fmt.Fprintf(os.Stderr, "%s %q: warning: %q has %d%% of its lifetime remaining, not renewed\n",
+					os.Args[0], f.hostPort, cert.Subject.CommonName, getRemaining(cert))
+			}
+			detail := newCertDetail(f.url, cert)
+			if chain {
+				detail.Position = getPosition(certs, i)
+			}
+			detail.NotValid = notValid
+			if cert == certs[leafCertI] {
+				detail.OCSP = f.ocspStatus
+				detail.CT = f.ctStatus
+			}
+			if path {
+				detail.Path = getSubjectPath(f.state)
+			}
+			if connectedIP {
+				detail.RemoteIP = f.info.remoteIP
+			}
+			if latency {
+				detail.Latency = f.info.handshake.Round(time.Microsecond).String()
+			}
+			if connection {
+				detail.TLSVersion = tlsVersions[f.state.Version]
+				detail.CipherSuite = tls.CipherSuiteName(f.state.CipherSuite)
+			}
+			if alpn {
+				detail.ALPN = f.state.NegotiatedProtocol
+			}
+			details = append(details, detail)
+			if serials {
+				serial := getSerialNumber(cert) // as written, hexadecimal if hexSerial == true
+				if issuersBySerial[serial] == nil {
+					issuersBySerial[serial] = map[string]string{}
+				}
+				issuer := cert.Issuer.String()
+				if _, ok := issuersBySerial[serial][issuer]; ok == false {
+					issuersBySerial[serial][issuer] = f.url
+				}
+			}
+		}
 	}
-	err = scanner.Err()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
-		os.Exit(4)
+	if stream {
+		streamOut := newStreamWriter()
+		onFetched = func(f *urlFetch) {
+			fetchedI := len(details)
+			process(f)
+			streamOut.write(details[fetchedI:])
+		}
+		for _, f := range fetches {
+			if f.err != nil {
+				process(f) // failed to parse, so is not fetched
+			}
+		}
+	}
+	// SIGINT cancels fetching, so details fetched so far are written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	fetchAll(ctx, fetches, onFetched)
+	stop() // so another SIGINT exits the program
+	if stream == false {
+		for _, f := range fetches {
+			process(f)
+		}
+	}
+	if serials {
+		warnSerialCollisions(issuersBySerial)
+	}
+	if stateName != "" {
+		err := updateState(run, details)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(ioExit)
+		}
+	}
+
+	// only listed are written and saved, all details count towards the exit status
+	listed := details
+	if (within > 0) || weakOnly {
+		withinTime := time.Now().Add(within)
+		listed = []certDetail{}
+		for _, detail := range details {
+			if (within > 0) && detail.Expires.After(withinTime) {
+				continue // ignore certificate expiring after within
+			}
+			if weakOnly && (detail.weak == false) {
+				continue // ignore certificate signed with a strong algorithm
+			}
+			listed = append(listed, detail)
+		}
+	}
+
+	if stream == false {
+		less := lessBy[sortField]
+		sort.SliceStable(listed, func(i, j int) bool {
+			if reverse {
+				return less(listed[j], listed[i])
+			}
+			return less(listed[i], listed[j])
+		})
+		if groupBy == groupByIssuer {
+			// keep the order of details within each issuer's section
+			sort.SliceStable(listed, func(i, j int) bool {
+				return listed[i].IssuerCN < listed[j].IssuerCN
+			})
+		}
+		writeDetails(listed, urlErrs)
+	}
+	if db != nil {
+		err := saveDetails(db, run, listed)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(ioExit)
+		}
+	}
+
+	expiring := map[string]bool{} // URLs with a certificate expiring within warn
+	if warn > 0 {
+		warnTime := time.Now().Add(warn)
+		for _, detail := range details {
+			if detail.Expires.Before(warnTime) {
+				expiring[detail.URL] = true
+			}
+		}
 	}
+	if suppressed > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d errors for URLs not written\n", os.Args[0], suppressed)
+	}
+	if interrupted > 0 {
+		fmt.Fprintf(os.Stderr, "%s: interrupted, %d URLs not fetched\n", os.Args[0], interrupted)
+	}
+	if summary {
+		fmt.Fprintf(os.Stderr, "checked %d, ok %d, failed %d, expiring-soon %d\n",
+			checked, checked-failures, failures, len(expiring))
+	}
+	if interrupted > 0 {
+		os.Exit(interruptedExit)
+	}
+	if (len(expiring) > 0) && exitOn[expiringCause] {
+		os.Exit(expiringExit)
+	}
+	if failedExiting {
+		os.Exit(failedExit)
+	}
+}
+
+// WarnSerialCollisions writes a warning to standard error for each serial number
+// in issuersBySerial with more than one issuer, giving the URL for each issuer.
+func warnSerialCollisions(issuersBySerial map[string]map[string]string) {
+	serialNumbers := []string{}
+	for serial, issuers := range issuersBySerial {
+		if len(issuers) > 1 {
+			serialNumbers = append(serialNumbers, serial)
+		}
+	}
+	sort.Strings(serialNumbers)
+	for _, serial := range serialNumbers {
+		issuers := []string{}
+		for issuer, url := range issuersBySerial[serial] {
+			issuers = append(issuers, fmt.Sprintf("%q at %s", issuer, url))
+		}
+		sort.Strings(issuers)
+		fmt.Fprintf(os.Stderr, "%s: warning: serial number %s from more than one issuer: %s\n",
+			os.Args[0], serial, strings.Join(issuers, ", "))
+	}
+}
 
-	if (noHeader == false) && (1 <= len(details)) {
-		fmt.Printf("%c expires,toExpiry,URL,serialNumber,issuerCN\n", comment)
+// WarnShortIntermediates writes a warning to standard error for each intermediate certificate
+// in state, fetched from hostPort, that expires before the leaf certificate,
+// when the leaf will stop validating although not expired.
+// Intermediates are taken from the first verified chain, or as fetched if not verified.
+func warnShortIntermediates(hostPort string, state tls.ConnectionState) {
+	certs := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certs = state.VerifiedChains[0]
+	}
+	leaf := certs[0]
+	for _, cert := range certs[1:] {
+		if isRoot(cert) || (cert.NotAfter.Before(leaf.NotAfter) == false) {
+			continue // root, or intermediate that outlives the leaf
+		}
+		fmt.Fprintf(os.Stderr, "%s %q: warning: intermediate %q expires %s, before leaf %q expires %s\n",
+			os.Args[0], hostPort, cert.Subject.CommonName, formatExpires(cert.NotAfter),
+			leaf.Subject.CommonName, formatExpires(leaf.NotAfter))
 	}
-	sort.Strings(details)
+}
+
+// WriteIssuerSections writes the fields got by fieldsOf of details, sorted by issuer, to out
+// in sections each headed by a comment line with the issuer CN and its number of certificates.
+func writeIssuerSections(out recordWriter, details []certDetail, fieldsOf func(certDetail) []string) {
+	counts := map[string]int{}
 	for _, detail := range details {
-		fmt.Println(detail)
+		counts[detail.IssuerCN]++
+	}
+	for i, detail := range details {
+		if (i == 0) || (detail.IssuerCN != details[i-1].IssuerCN) {
+			// section header is not CSV so must follow any records buffered
+			out.Flush()
+			fmt.Fprintf(output, "%s issuer %q: %d certificates\n",
+				comment, detail.IssuerCN, counts[detail.IssuerCN])
+		}
+		out.Write(fieldsOf(detail))
+	}
+}
+
+// NewRecordWriter returns out == a recordWriter of output as CSV,
+// as tab separated values if tsvOut == true or as a Markdown table if mdOut == true,
+// and fieldsOf == certDetail.fields, or colorFields if output is a terminal and not a Markdown table.
+func newRecordWriter() (out recordWriter, fieldsOf func(certDetail) []string) {
+	// csv quotes fields containing separator or quotes, such as some issuer CNs with commas
+	csvOut := csv.NewWriter(output)
+	csvOut.Comma = separator
+	out = csvOut
+	if tsvOut {
+		out = newTSVWriter(output)
+	}
+	if mdOut {
+		out = newMarkdownWriter(output)
+	}
+	fieldsOf = certDetail.fields
+	if (mdOut == false) && isColorTerminal(output) {
+		fieldsOf = colorFields
+	}
+	return out, fieldsOf
+}
+
+// WriteHeader writes the header to out, starting with comment,
+// unless noHeader == true or details are grouped, when each section has its own.
+// A Markdown table always has a header row, without a comment.
+func writeHeader(out recordWriter) {
+	switch {
+	case mdOut:
+		out.Write(header())
+	case (noHeader == false) && (groupBy == ""):
+		names := header()
+		if comment != "" {
+			names[0] = fmt.Sprintf("%s %s", comment, names[0])
+		}
+		out.Write(names)
+	}
+}
+
+// WriteDetails writes urlErrs then details to output as CSV,
+// as tab separated values if tsvOut == true, as a Markdown table if mdOut == true,
+// with toExpiry colored if output is a terminal and not a Markdown table,
+// as an HTML page if htmlOut == true, by executing detailTemplate if not nil,
+// as a JSON array if jsonOut == true or as Prometheus metrics if promOut == true.
+func writeDetails(details []certDetail, urlErrs []urlError) {
+	if promOut {
+		writeMetrics(details, urlErrs)
+		return
+	}
+	if htmlOut {
+		writeHTML(details, urlErrs)
+		return
+	}
+	if detailTemplate != nil {
+		// urlErrs is empty, as errorsOut cannot be given with a template
+		writeTemplate(details)
+		return
+	}
+	if jsonOut {
+		// header is not written as JSON names each field
+		records := []any{}
+		for _, urlErr := range urlErrs {
+			records = append(records, urlErr)
+		}
+		for _, detail := range details {
+			records = append(records, detail)
+		}
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			// cannot get here, details only contains strings and times
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+			os.Exit(ioExit)
+		}
+		fmt.Fprintln(output, string(out))
+		return
+	}
+
+	out, fieldsOf := newRecordWriter()
+	if len(details)+len(urlErrs) > 0 {
+		// no header without records
+		writeHeader(out)
+	}
+	for _, urlErr := range urlErrs {
+		out.Write(urlErr.fields())
+	}
+	if (groupBy == groupByIssuer) && (mdOut == false) {
+		writeIssuerSections(out, details, fieldsOf)
+	} else {
+		for _, detail := range details {
+			out.Write(fieldsOf(detail))
+		}
+	}
+	out.Flush()
+	err := out.Error()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		os.Exit(ioExit)
 	}
 }
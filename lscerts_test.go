@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetHostPort(t *testing.T) {
+	saved := defaultScheme
+	t.Cleanup(func() { defaultScheme = saved })
+	defaultScheme = "https" // as by default, flags are not parsed in tests
+	tests := []struct {
+		str      string
+		hostPort string // "" if str fails to parse
+	}{
+		{"[2001:db8::1]", "[2001:db8::1]:443"},
+		{"[2001:db8::1]:8443", "[2001:db8::1]:8443"},
+		{"https://[2001:db8::1]/path", "[2001:db8::1]:443"},
+		{"bücher.example", "xn--bcher-kva.example:443"},
+		{"host.example.com:443", "host.example.com:443"},
+		{"host.example.com:8443", "host.example.com:8443"},
+		{"host.example.com", "host.example.com:443"},
+		{":8443", ""},
+		{"example.com:99999", ""},
+		{"example.com:0", ""},
+		{"example.com:https", ""},
+		{"https://example.com:65536/", ""},
+	}
+	for _, test := range tests {
+		_, hostPort, err := getHostPort(test.str)
+		if (hostPort != test.hostPort) || ((err == nil) != (test.hostPort != "")) {
+			t.Errorf("getHostPort(%q) = %q, %v, want %q", test.str, hostPort, err, test.hostPort)
+		}
+	}
+}
+
+func TestRoundDown(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		now, then time.Time
+		rounded   string
+	}{
+		{date(2023, 3, 1), date(2023, 3, 1).Add(30 * time.Minute), "<1h"},
+		{date(2023, 3, 1), date(2023, 3, 2), "24h"},
+		{date(2023, 3, 1), date(2023, 3, 8), "7d"},
+		{date(2023, 3, 1), date(2023, 3, 9), "1w"},
+		// 2024 is a leap year, so a year from 2023-03-01 is 366 days
+		{date(2023, 3, 1), date(2024, 2, 29), "52w"},
+		{date(2023, 3, 1), date(2024, 3, 1), "1y"},
+		{date(2023, 3, 1), date(2025, 2, 28), "1y"},
+		{date(2023, 3, 1), date(2025, 3, 1), "2y"},
+		// a year from 2024-02-29 is 2025-03-01
+		{date(2024, 2, 29), date(2025, 2, 28), "52w"},
+		{date(2024, 2, 29), date(2025, 3, 1), "1y"},
+		{date(2024, 2, 29), date(2026, 2, 28), "1y"},
+		{date(2024, 2, 29), date(2026, 3, 1), "2y"},
+	}
+	for _, test := range tests {
+		rounded := roundDown(test.now, test.then)
+		if rounded != test.rounded {
+			t.Errorf("roundDown(%v, %v) = %q, want %q", test.now, test.then, rounded, test.rounded)
+		}
+	}
+}
+
+func TestShortenSerial(t *testing.T) {
+	saved := serialMax
+	t.Cleanup(func() { serialMax = saved })
+	serial := strings.Repeat("1234567890", 30) // 300 digits, as in a malformed certificate
+	tests := []struct {
+		serial    string
+		serialMax int
+		shortened string
+	}{
+		{serial, 0, serial},
+		{"12345", 5, "12345"},
+		{serial, 1, "1"},
+		{serial, 3, "123"},
+		{serial, 4, "1..."},
+		{serial, 8, "123...90"},
+		{serial, 9, "123...890"},
+		{serial, 64, serial[:31] + "..." + serial[270:]},
+	}
+	for _, test := range tests {
+		serialMax = test.serialMax
+		shortened := shortenSerial(test.serial)
+		if shortened != test.shortened {
+			t.Errorf("serialMax %d: shortenSerial(%q) = %q, want %q",
+				test.serialMax, test.serial, shortened, test.shortened)
+		}
+		if (test.serialMax > 0) && (len(shortened) > test.serialMax) {
+			t.Errorf("serialMax %d: shortenSerial(%q) is %d characters long",
+				test.serialMax, test.serial, len(shortened))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// if nagios == true then check the leaf certificate of one URL as a Nagios plugin
+const nagiosFlag = "nagios"
+const nagiosText = "check one URL as a Nagios plugin, writing a status line " +
+	"and exiting with status 0 OK, 1 WARNING (within -w), 2 CRITICAL (within -c) or 3 UNKNOWN"
+
+var nagios bool
+
+// if critical > 0 and nagios == true then a certificate that expires within critical is CRITICAL
+const criticalFlag = "c"
+const criticalText = "with -nagios, CRITICAL if the certificate expires within this long, for example 168h"
+
+var critical time.Duration
+
+// Nagios plugin exit statuses
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+// NagiosStatuses are how Nagios plugin exit statuses are written, indexed by status.
+var nagiosStatuses = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// CheckNagios fetches the leaf certificate of the one URL in lines
+// and compares its expiry with warn and critical
+// returning status == nagiosOK, nagiosWarning or nagiosCritical
+// and line, a plugin output line with the days until expiry as performance data.
+// If there is not exactly one URL or it fails to parse, checkNagios returns status == nagiosUnknown.
+// If it fails to fetch or validate the certificate, checkNagios returns status == nagiosCritical.
+func checkNagios(lines []string) (status int, line string) {
+	output := func(status int, msg string) (int, string) {
+		return status, fmt.Sprintf("CERT %s - %s", nagiosStatuses[status], msg)
+	}
+	if len(lines) != 1 {
+		return output(nagiosUnknown, fmt.Sprintf("want 1 URL, got %d", len(lines)))
+	}
+	urlStr, serverName, _ := strings.Cut(lines[0], serverNameSep)
+	scheme, hostPort, err := getHostPort(urlStr)
+	if err != nil {
+		return output(nagiosUnknown, err.Error())
+	}
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(hostPort)
+	}
+	serverName, err = getASCIIHost(serverName)
+	if err != nil {
+		return output(nagiosUnknown, fmt.Sprintf("%s %q: server name: %v", os.Args[0], lines[0], err))
+	}
+	state, _, err := fetchCert(context.Background(), scheme, hostPort, serverName)
+	if err != nil {
+		return output(nagiosCritical, err.Error())
+	}
+	expires := state.PeerCertificates[0].NotAfter
+
+	const hoursPerDay = 24
+	days := func(d time.Duration) int {
+		return int(d.Hours() / hoursPerDay)
+	}
+	toExpiry := time.Until(expires)
+	switch {
+	case toExpiry <= 0 || ((critical > 0) && (toExpiry < critical)):
+		status = nagiosCritical
+	case (warn > 0) && (toExpiry < warn):
+		status = nagiosWarning
+	default:
+		status = nagiosOK
+	}
+	perfData := fmt.Sprintf("days=%d;", days(toExpiry))
+	if warn > 0 {
+		perfData += fmt.Sprint(days(warn))
+	}
+	perfData += ";"
+	if critical > 0 {
+		perfData += fmt.Sprint(days(critical))
+	}
+	_, line = output(status, fmt.Sprintf("%s expires %s (%s) | %s",
+		urlStr, formatExpires(expires), getToExpiry(expires), perfData))
+	return status, line
+}
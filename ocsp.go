@@ -0,0 +1,83 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// if checkOCSP == true then check whether each leaf certificate is revoked using OCSP
+const ocspFlag = "ocsp"
+const ocspText = "check whether each leaf certificate is revoked " +
+	"with its CA's OCSP responder: good, revoked or unknown"
+
+var checkOCSP bool
+
+// OCSPStatuses maps OCSP response statuses to how they are written.
+var ocspStatuses = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// GetOCSPStatus asks the OCSP responder of the leaf certificate in certs,
+// a chain with the leaf certificate first, whether the leaf is revoked
+// returning status == good, revoked or unknown and err == nil.
+// If failed to get a response, getOCSPStatus returns status == "unknown" and err != nil.
+func getOCSPStatus(certs []*x509.Certificate) (status string, err error) {
+	const unknown = "unknown"
+	leaf := certs[0]
+	switch {
+	case len(leaf.OCSPServer) == 0:
+		return unknown, errors.New("no OCSP responder in certificate")
+	case len(certs) < 2:
+		return unknown, errors.New("no issuer certificate in chain for OCSP request")
+	}
+	issuer := certs[1]
+
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return unknown, fmt.Errorf("OCSP request: %w", err)
+	}
+	client := &http.Client{Transport: newTransport(), Timeout: timeout}
+	responder := leaf.OCSPServer[0]
+	reply, err := client.Post(responder, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return unknown, fmt.Errorf("OCSP: %w", err)
+	}
+	defer reply.Body.Close()
+	if reply.StatusCode != http.StatusOK {
+		return unknown, fmt.Errorf("OCSP %s: %s", responder, reply.Status)
+	}
+	body, err := io.ReadAll(reply.Body)
+	if err != nil {
+		return unknown, fmt.Errorf("OCSP %s: %w", responder, err)
+	}
+	response, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return unknown, fmt.Errorf("OCSP %s: %w", responder, err)
+	}
+	return ocspStatuses[response.Status], nil
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parallel is how many URLs to fetch certificates from at the same time
+const parallelFlag = "p"
+const parallelText = "fetch certificates from this many URLs at the same time, " +
+	"though only one at a time from the same host and port"
+
+var parallel int
+
+// URLFetch is a URL read from a line of input and the result of fetching its certificates.
+type urlFetch struct {
+	urlStr     string // read from a line of input, without any server name
+	scheme     string // of the URL
+	hostPort   string // to fetch certificates from, or fetched from if redirected
+	serverName string // to send in the TLS handshake, or sent if redirected
+	err        error  // from parsing line or fetching, nil if the certificates were fetched
+	parseErr   bool   // err is from parsing line
+
+	url        string              // urlStr, or the URL redirected to if follow == true
+	state      tls.ConnectionState // of the TLS connection certificates were fetched on
+	info       connInfo            // about the connection
+	ocspStatus string              // of the leaf certificate, if checkOCSP == true
+	ocspErr    error               // from getting ocspStatus
+	ctStatus   string              // of the leaf certificate, if checkCT == true
+	ctErr      error               // from getting ctStatus
+}
+
+// ErrInterrupted is the error of a URL not fetched, or whose fetch was cancelled,
+// as the program was interrupted.
+var errInterrupted = errors.New("not fetched, interrupted")
+
+// Fetch fetches the certificates of f, and their OCSP status if checkOCSP == true
+// and CT status if checkCT == true, setting the results in f.
+// If publicOnly == true and the host is not public, f.err wraps errNotPublic.
+// If ctx is cancelled, f.err wraps errInterrupted.
+func (f *urlFetch) fetch(ctx context.Context) {
+	f.url = f.urlStr
+	if publicOnly {
+		f.err = checkPublic(f.hostPort)
+		if f.err != nil {
+			return
+		}
+	}
+	if follow && (f.scheme == "https") {
+		// later warnings and checks are for the host redirected to, if any
+		var redirected string
+		redirected, f.hostPort, f.serverName, f.state, f.info, f.err =
+			fetchRedirectedCert(ctx, f.urlStr, f.hostPort, f.serverName)
+		if redirected != "" {
+			f.url = redirected
+		}
+	} else {
+		f.state, f.info, f.err = fetchCert(ctx, f.scheme, f.hostPort, f.serverName)
+	}
+	if (f.err != nil) && (ctx.Err() != nil) {
+		// whatever the error, it was most likely from ctx being cancelled
+		f.err = fmt.Errorf("%s %q: %w", os.Args[0], f.hostPort, errInterrupted)
+	}
+	if (f.err != nil) || (ctx.Err() != nil) {
+		return
+	}
+	if checkOCSP {
+		f.ocspStatus, f.ocspErr = getOCSPStatus(f.state.PeerCertificates)
+		if f.ocspErr != nil {
+			f.ocspErr = fmt.Errorf("%s %q: %w", os.Args[0], f.hostPort, f.ocspErr)
+		}
+	}
+	if checkCT {
+		f.ctStatus, f.ctErr = getCTStatus(f.state.PeerCertificates)
+		if f.ctErr != nil {
+			f.ctErr = fmt.Errorf("%s %q: %w", os.Args[0], f.hostPort, f.ctErr)
+		}
+	}
+}
+
+// WriteDiagnostics writes about fetching the certificates of f to standard error:
+// the IP address connected to, the TLS version, cipher suite and any application protocol
+// negotiated, how long connecting and the handshake took and the subject of each certificate.
+func (f *urlFetch) writeDiagnostics() {
+	prefix := fmt.Sprintf("%s %q:", os.Args[0], f.hostPort)
+	fmt.Fprintf(os.Stderr, "%s connected to %s in %v\n",
+		prefix, f.info.remoteIP, f.info.connect.Round(time.Microsecond))
+	protocol := ""
+	if f.state.NegotiatedProtocol != "" {
+		protocol = ", protocol " + f.state.NegotiatedProtocol
+	}
+	fmt.Fprintf(os.Stderr, "%s %s %s handshake with %q in %v%s\n",
+		prefix, tlsVersions[f.state.Version], tls.CipherSuiteName(f.state.CipherSuite),
+		f.serverName, f.info.handshake.Round(time.Microsecond), protocol)
+	for i, cert := range f.state.PeerCertificates {
+		fmt.Fprintf(os.Stderr, "%s certificate %d %q issued by %q\n", prefix, i, cert.Subject, cert.Issuer)
+	}
+}
+
+// FetchAll fetches the certificates of each URL in fetches that parsed,
+// with f.err == nil, from up to parallel URLs at the same time.
+// URLs for the same host and port are fetched one at a time, in order,
+// so as not to be rate limited by the host.
+// After fetching each URL, fetchAll calls fetched with it, one call at a time.
+// If progress == true, fetchAll writes how many URLs have been fetched to standard error.
+// Once ctx is cancelled, URLs not yet fetched are not, their f.err wrapping errInterrupted.
+func fetchAll(ctx context.Context, fetches []*urlFetch, fetched func(f *urlFetch)) {
+	hosts := []string{}                // in order of first URL
+	byHost := map[string][]*urlFetch{} // URLs to fetch for each host and port
+	toFetch := 0
+	for _, f := range fetches {
+		if f.err != nil {
+			continue // ignore URL that failed to parse
+		}
+		host := strings.ToLower(f.hostPort)
+		if _, ok := byHost[host]; ok == false {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], f)
+		toFetch++
+	}
+
+	queue := make(chan []*urlFetch)
+	var workers sync.WaitGroup
+	var fetchedMu sync.Mutex
+	fetchedCount := 0
+	for w := 0; w < parallel; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for hostFetches := range queue {
+				for _, f := range hostFetches {
+					if ctx.Err() != nil {
+						f.err = fmt.Errorf("%s %q: %w", os.Args[0], f.hostPort, errInterrupted)
+					} else {
+						f.fetch(ctx)
+					}
+					fetchedMu.Lock()
+					fetchedCount++
+					if progress {
+						fmt.Fprintf(os.Stderr, "fetched %d/%d\n", fetchedCount, toFetch)
+					}
+					fetched(f)
+					fetchedMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, host := range hosts {
+		queue <- byHost[host]
+	}
+	close(queue)
+	workers.Wait()
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// if promOut == true then write certificate details as Prometheus metrics instead of CSV
+const promFlag = "prom"
+const promText = "write certificate details and errors as Prometheus metrics, " +
+	"for the node exporter textfile collector, instead of CSV"
+
+var promOut bool
+
+// PromLabelEscaper escapes a Prometheus label value.
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes details and urlErrs to output as Prometheus metrics in text format:
+// ssl_cert_not_after for each certificate and ssl_cert_fetch_error for each URL.
+// If failed to write, writeMetrics will write the error to standard error then exit the program.
+func writeMetrics(details []certDetail, urlErrs []urlError) {
+	out := bufio.NewWriter(output)
+	label := func(name, value string) string {
+		return fmt.Sprintf("%s=\"%s\"", name, promLabelEscaper.Replace(value))
+	}
+
+	fmt.Fprintln(out, "# HELP ssl_cert_not_after When the certificate expires, in seconds since the Unix epoch.")
+	fmt.Fprintln(out, "# TYPE ssl_cert_not_after gauge")
+	for _, detail := range details {
+		fmt.Fprintf(out, "ssl_cert_not_after{%s,%s,%s} %d\n", label("url", detail.URL),
+			label("issuer", detail.IssuerCN), label("serial", detail.SerialNumber), detail.Expires.Unix())
+	}
+
+	fmt.Fprintln(out, "# HELP ssl_cert_fetch_error Whether fetching certificates from the URL failed.")
+	fmt.Fprintln(out, "# TYPE ssl_cert_fetch_error gauge")
+	fetched := map[string]bool{}
+	for _, detail := range details {
+		if fetched[detail.URL] {
+			continue // with chain == true, a URL has a detail for each certificate
+		}
+		fetched[detail.URL] = true
+		fmt.Fprintf(out, "ssl_cert_fetch_error{%s} 0\n", label("url", detail.URL))
+	}
+	for _, urlErr := range urlErrs {
+		fmt.Fprintf(out, "ssl_cert_fetch_error{%s} 1\n", label("url", urlErr.URL))
+	}
+
+	err := out.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		os.Exit(ioExit)
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	netproxy "golang.org/x/net/proxy"
+)
+
+// if proxy != nil then fetch certificates through an HTTP CONNECT tunnel to this proxy,
+// or through this SOCKS5 proxy if its scheme is socks5Scheme
+const proxyFlag = "proxy"
+const proxyText = "fetch certificates through this HTTP proxy, " +
+	"by default from environment variable HTTPS_PROXY or ALL_PROXY, except for hosts in NO_PROXY"
+
+var proxy *url.URL
+
+// if envProxy != nil then it returns the proxy, from environment variables, to fetch certificates
+// from an https URL through, or nil for a host in NO_PROXY, used if proxy == nil
+var envProxy func(reqURL *url.URL) (*url.URL, error)
+
+// the SOCKS5 proxy to fetch certificates through, instead of an HTTP proxy
+const socks5Flag = "socks5"
+const socks5Text = "fetch certificates through the SOCKS5 proxy at this host:port, such as a bastion, " +
+	"instead of an HTTP proxy"
+
+// Socks5Scheme is the scheme of proxy for a SOCKS5 proxy.
+const socks5Scheme = "socks5"
+
+// if source != nil then connect from this local address
+const sourceFlag = "source"
+const sourceText = "connect from this local IP address, on a host with more than one"
+
+var source *net.TCPAddr
+
+// if publicOnly == true then skip hosts with private, loopback or link-local addresses
+const publicOnlyFlag = "public-only"
+const publicOnlyText = "skip URLs for hosts with a private, loopback or link-local IP address, " +
+	"writing that they are skipped to standard error"
+
+var publicOnly bool
+
+// ErrNotPublic is returned by checkPublic for a host with an address that is not public.
+var errNotPublic = errors.New("skipped, address not public")
+
+// CheckPublic looks up the IP addresses of the host in hostPort returning err == nil
+// if they are all public or the lookup fails, when fetching certificates will fail too.
+// If any address is private, loopback, link-local or unspecified,
+// checkPublic returns err wrapping errNotPublic.
+func checkPublic(hostPort string) (err error) {
+	host, _, _ := net.SplitHostPort(hostPort)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+			ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			return fmt.Errorf("%s %q: %w: %s", os.Args[0], hostPort, errNotPublic, ip)
+		}
+	}
+	return nil
+}
+
+// GetIPHostPorts looks up the IP addresses of the host in hostPort
+// returning hostPorts == "<IP address>:<portNumber>" for each address and err == nil.
+// If the host is an IP address, getIPHostPorts returns hostPorts == just hostPort.
+// If failed to look up the host, getIPHostPorts returns hostPorts == nil and err != nil.
+func getIPHostPorts(hostPort string) (hostPorts []string, err error) {
+	host, port, _ := net.SplitHostPort(hostPort)
+	if net.ParseIP(host) != nil {
+		return []string{hostPort}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, err)
+	}
+	for _, ip := range ips {
+		hostPorts = append(hostPorts, net.JoinHostPort(ip.String(), port))
+	}
+	return hostPorts, nil
+}
+
+// GetSource parses str as a local IP address to connect from
+// returning source == the address, with any port, and err == nil.
+// If str is "", getSource returns source == nil and err == nil.
+// If str is not an IP address of this host, getSource returns source == nil and err != nil.
+func getSource(str string) (source *net.TCPAddr, err error) {
+	if str == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(str)
+	if ip == nil {
+		return nil, fmt.Errorf("%s source %q: not an IP address", os.Args[0], str)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("%s source %q: %w", os.Args[0], str, err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s source %q: not an IP address of this host", os.Args[0], str)
+}
+
+// NewDialer returns a dialer that connects from source, if not nil, by deadline.
+func newDialer(deadline time.Time) (dialer *net.Dialer) {
+	dialer = &net.Dialer{Deadline: deadline}
+	if source != nil {
+		// only set if not nil, as LocalAddr is an interface
+		dialer.LocalAddr = source
+	}
+	return dialer
+}
+
+// NewTransport returns an HTTP transport that connects from source, if not nil,
+// and through the proxy, HTTP or SOCKS5, got by getProxyFor each host, if any.
+func newTransport() (transport *http.Transport) {
+	transport = &http.Transport{DialContext: newDialer(time.Time{}).DialContext}
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		return getProxyFor(request.URL.Host), nil
+	}
+	return transport
+}
+
+// GetProxyFor returns the proxy to connect to hostPort through: proxy if not nil,
+// otherwise that got by envProxy if not nil, or nil to connect directly.
+func getProxyFor(hostPort string) (hostProxy *url.URL) {
+	if (proxy != nil) || (envProxy == nil) {
+		return proxy
+	}
+	// envProxy only fails if its proxy does not parse, which getEnvProxyFunc checked
+	hostProxy, _ = envProxy(&url.URL{Scheme: "https", Host: hostPort})
+	return hostProxy
+}
+
+// GetProxy parses str as the URL of an HTTP proxy, such as http://proxy.example.com:3128,
+// returning proxy == the URL, with the port set, and err == nil.
+// If str is "", getProxy returns proxy == nil and err == nil.
+// If failed to parse an HTTP URL, getProxy returns proxy == nil and err != nil.
+func getProxy(str string) (proxy *url.URL, err error) {
+	if str == "" {
+		return nil, nil
+	}
+	if strings.Contains(str, "://") == false {
+		str = "http://" + str
+	}
+	proxy, err = url.Parse(str)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s proxy %w", os.Args[0], err)
+	case proxy.Scheme != "http":
+		return nil, fmt.Errorf("%s proxy %q: url scheme not http", os.Args[0], str)
+	case proxy.Hostname() == "":
+		return nil, fmt.Errorf("%s proxy %q: no host", os.Args[0], str)
+	}
+	if proxy.Port() == "" {
+		proxy.Host = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	return proxy, nil
+}
+
+// GetSOCKS5 parses str as the "<hostName>:<portNumber>" of a SOCKS5 proxy
+// returning proxy == its URL, with scheme socks5Scheme, and err == nil.
+// If failed to parse str, getSOCKS5 returns proxy == nil and err != nil.
+func getSOCKS5(str string) (proxy *url.URL, err error) {
+	host, port, err := net.SplitHostPort(str)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s socks5 %q: not host:port", os.Args[0], str)
+	case host == "":
+		return nil, fmt.Errorf("%s socks5 %q: no host", os.Args[0], str)
+	case isPort(port) == false:
+		return nil, fmt.Errorf("%s socks5 %q: port not a number from 1 to 65535", os.Args[0], str)
+	}
+	return &url.URL{Scheme: socks5Scheme, Host: net.JoinHostPort(host, port)}, nil
+}
+
+// GetEnv returns the value of the first environment variable set of names,
+// or "" if none are set.
+func getEnv(names ...string) (str string) {
+	for _, name := range names {
+		str = os.Getenv(name)
+		if str != "" {
+			return str
+		}
+	}
+	return ""
+}
+
+// GetEnvProxyFunc returns envProxy for the proxy in the first environment variable set
+// of HTTPS_PROXY, https_proxy, ALL_PROXY or all_proxy, and the hosts in NO_PROXY or no_proxy
+// which are connected to directly, as are loopback addresses, as Go's HTTP client does.
+// If none are set, getEnvProxyFunc returns envProxy == nil.
+// If the proxy is not an HTTP or SOCKS5 URL, getEnvProxyFunc writes a warning to standard error
+// and returns envProxy == nil, rather than stop lscerts being run where another program needs it.
+func getEnvProxyFunc() (envProxy func(reqURL *url.URL) (*url.URL, error)) {
+	str := getEnv("HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy")
+	if str == "" {
+		return nil
+	}
+	var envURL *url.URL
+	var err error
+	switch {
+	case strings.HasPrefix(str, "socks5://") || strings.HasPrefix(str, "socks5h://"):
+		// the SOCKS5 proxy always looks up the host, as socks5h means
+		_, hostPort, _ := strings.Cut(str, "://")
+		envURL, err = getSOCKS5(strings.TrimSuffix(hostPort, "/"))
+	default:
+		envURL, err = getProxy(str)
+	}
+	if err != nil {
+		message := strings.TrimPrefix(err.Error(), os.Args[0]+" ") // named below
+		fmt.Fprintf(os.Stderr, "%s: warning: %s, from the environment so connecting directly\n",
+			os.Args[0], message)
+		return nil
+	}
+	config := &httpproxy.Config{HTTPSProxy: envURL.String(), NoProxy: getEnv("NO_PROXY", "no_proxy")}
+	return config.ProxyFunc()
+}
+
+// Dial connects to hostPort, directly or through the proxy got by getProxyFor, if any,
+// before deadline returning conn == the connection and err == nil.
+// If failed to connect, or ctx is cancelled, dial returns conn == nil and err != nil.
+func dial(ctx context.Context, hostPort string, deadline time.Time) (conn net.Conn, err error) {
+	dialer := newDialer(deadline)
+	proxy := getProxyFor(hostPort)
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", hostPort)
+	}
+	if proxy.Scheme == socks5Scheme {
+		return dialSOCKS5(ctx, proxy, hostPort, deadline)
+	}
+
+	conn, err = dialer.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(deadline)
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: hostPort},
+		Host:   hostPort,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := proxy.User.Username() + ":" + password
+		request.Header.Set("Proxy-Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	err = request.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: CONNECT %s", proxy.Host, response.Status)
+	}
+	if reader.Buffered() > 0 {
+		// such as an SMTP server's greeting, read with the response
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// BufferedConn is a connection whose first bytes were read into reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads the bytes buffered by reader, until there are none, then from the connection.
+func (c *bufferedConn) Read(b []byte) (n int, err error) {
+	if c.reader.Buffered() > 0 {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// DialSOCKS5 connects to hostPort through proxy, a SOCKS5 proxy,
+// before deadline returning conn == the connection and err == nil.
+// The proxy relays the TLS handshake so certificates fetched are hostPort's, not the proxy's.
+// If failed to connect, or ctx is cancelled, dialSOCKS5 returns conn == nil and err != nil.
+func dialSOCKS5(ctx context.Context, proxy *url.URL, hostPort string,
+	deadline time.Time) (conn net.Conn, err error) {
+	socks5, err := netproxy.SOCKS5("tcp", proxy.Host, nil, newDialer(deadline))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	// the dialer returned by SOCKS5 is always a ContextDialer, which stops at deadline
+	// and whose errors name the proxy
+	return socks5.(netproxy.ContextDialer).DialContext(ctx, "tcp", hostPort)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// if tsvOut == true then write certificate details as tab separated values instead of CSV
+const tsvFlag = "tsv"
+const tsvText = "write certificate details as tab separated values instead of CSV"
+
+var tsvOut bool
+
+// if mdOut == true then write certificate details as a Markdown table instead of CSV
+const mdFlag = "md"
+const mdText = "write certificate details as a Markdown table instead of CSV"
+
+var mdOut bool
+
+// RecordWriter writes records of fields, as csv.Writer does.
+type recordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// LineWriter buffers lines for the recordWriters below.
+type lineWriter struct {
+	out *bufio.Writer
+	err error // from the first failed write or Flush
+}
+
+// WriteLine writes line followed by a newline.
+func (w *lineWriter) writeLine(line string) error {
+	if w.err == nil {
+		_, w.err = w.out.WriteString(line + "\n")
+	}
+	return w.err
+}
+
+// Flush writes any buffered lines.
+func (w *lineWriter) Flush() {
+	if w.err == nil {
+		w.err = w.out.Flush()
+	}
+}
+
+// Error returns the error from the first failed write or Flush, if any.
+func (w *lineWriter) Error() error {
+	return w.err
+}
+
+// Escape returns record with each field escaped by escaper.
+func escape(record []string, escaper *strings.Replacer) (escaped []string) {
+	escaped = make([]string, len(record))
+	for i, field := range record {
+		escaped[i] = escaper.Replace(field)
+	}
+	return escaped
+}
+
+// TSVWriter is a recordWriter of lines of tab separated fields, which are never quoted.
+type tsvWriter struct {
+	lineWriter
+}
+
+// TSVEscaper replaces the tabs and line breaks that would split a field with spaces.
+var tsvEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// NewTSVWriter returns a tsvWriter that writes to w.
+func newTSVWriter(w io.Writer) *tsvWriter {
+	return &tsvWriter{lineWriter{out: bufio.NewWriter(w)}}
+}
+
+// Write writes record as a line of tab separated fields.
+func (w *tsvWriter) Write(record []string) error {
+	return w.writeLine(strings.Join(escape(record, tsvEscaper), "\t"))
+}
+
+// MarkdownWriter is a recordWriter of the rows of a Markdown table,
+// the first record being the header row.
+type markdownWriter struct {
+	lineWriter
+	rows int // written so far
+}
+
+// MarkdownEscaper escapes the pipes and replaces the line breaks that would split a table cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ")
+
+// NewMarkdownWriter returns a markdownWriter that writes to w.
+func newMarkdownWriter(w io.Writer) *markdownWriter {
+	return &markdownWriter{lineWriter: lineWriter{out: bufio.NewWriter(w)}}
+}
+
+// Write writes record as a table row,
+// followed by the row separating the header from the body if it is the first.
+func (w *markdownWriter) Write(record []string) error {
+	w.writeLine("| " + strings.Join(escape(record, markdownEscaper), " | ") + " |")
+	if w.rows == 0 {
+		rule := make([]string, len(record))
+		for i := range rule {
+			rule[i] = "---"
+		}
+		w.writeLine("| " + strings.Join(rule, " | ") + " |")
+	}
+	w.rows++
+	return w.err
+}
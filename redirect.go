@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// if follow == true then fetch certificates from the host that an https URL redirects to
+const followFlag = "follow"
+const followText = "fetch certificates from the host that each https URL redirects to, if any"
+
+var follow bool
+
+// MaxRedirects is how many HTTP redirects followRedirects follows before giving up.
+const maxRedirects = 10
+
+// FetchRedirectedCert follows HTTP redirects from urlStr, an https URL for hostPort,
+// then fetches certificates from the host redirected to last as fetchCert,
+// returning redirected == the URL redirected to last, or "" if not redirected,
+// toHostPort and toServerName == the host and port fetched from and the server name sent,
+// hostPort and serverName if not redirected, state and info as fetchCert and err == nil.
+// If failed to follow redirects or fetch certificates, or ctx is cancelled, returns err != nil.
+func fetchRedirectedCert(ctx context.Context, urlStr, hostPort, serverName string) (redirected,
+	toHostPort, toServerName string, state tls.ConnectionState, info connInfo, err error) {
+	first := "https://" + hostPort + getPath(urlStr)
+	last, err := followRedirects(ctx, first, serverName)
+	if err != nil {
+		return "", hostPort, serverName, state, info, fmt.Errorf("%s %q: %w", os.Args[0], hostPort, err)
+	}
+	if last == first {
+		state, info, err = fetchCert(ctx, "https", hostPort, serverName)
+		return "", hostPort, serverName, state, info, err
+	}
+
+	_, toHostPort, err = getHostPort(last)
+	if err != nil {
+		return "", hostPort, serverName, state, info, err
+	}
+	toServerName, _, _ = net.SplitHostPort(toHostPort)
+	state, info, err = fetchCert(ctx, "https", toHostPort, toServerName)
+	return last, toHostPort, toServerName, state, info, err
+}
+
+// FollowRedirects sends HEAD requests from first, an https URL,
+// following redirects to other https URLs up to maxRedirects
+// returning last == the URL that was not redirected and err == nil.
+// The request to first is for serverName, sent in the TLS handshake and as the Host header,
+// and those redirected to for the host of their URL.
+// If a request failed, ctx is cancelled or there were too many redirects,
+// followRedirects returns err != nil.
+func followRedirects(ctx context.Context, first, serverName string) (last string, err error) {
+	last = first
+	for i := 0; i < maxRedirects; i++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodHead, last, nil)
+		if err != nil {
+			return "", err
+		}
+		hopServerName := "" // the host of last
+		if i == 0 {
+			hopServerName = serverName
+			if request.URL.Port() != "443" {
+				request.Host = net.JoinHostPort(serverName, request.URL.Port())
+			} else {
+				request.Host = serverName
+			}
+		}
+		client := newRedirectClient(hopServerName)
+		reply, err := client.Do(request)
+		client.CloseIdleConnections()
+		if err != nil {
+			return "", err
+		}
+		reply.Body.Close()
+		location, err := reply.Location()
+		if (reply.StatusCode < 300) || (399 < reply.StatusCode) || (err != nil) ||
+			(location.Scheme != "https") {
+			return last, nil // not redirected, or not to an https URL
+		}
+		last = location.String()
+	}
+	return "", fmt.Errorf("stopped after %d redirects", maxRedirects)
+}
+
+// GetPath returns the path, query and fragment of urlStr, a URL with or without a scheme,
+// or "" if it has none.
+func getPath(urlStr string) (path string) {
+	_, rest, found := strings.Cut(urlStr, "://")
+	if found == false {
+		rest = urlStr
+	}
+	i := strings.IndexAny(rest, "/?#")
+	if i < 0 {
+		return ""
+	}
+	return rest[i:]
+}
+
+// NewRedirectClient returns an HTTP client that does not follow redirects
+// and sends serverName in the TLS handshake, or the host of each URL if serverName == "".
+func newRedirectClient(serverName string) (client *http.Client) {
+	transport := newTransport()
+	transport.TLSClientConfig = &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            rootCAs,
+		Certificates:       clientCerts,
+		InsecureSkipVerify: insecure,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // redirects are followed by followRedirects, to check each is https
+		},
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+)
+
+// StartTLS maps URL schemes, whose protocols upgrade a plain connection to TLS,
+// to the function that does the upgrade on conn before the TLS handshake.
+// Schemes not in startTLS, such as https, do the TLS handshake on connecting.
+var startTLS = map[string]func(conn net.Conn) error{
+	"smtp": startTLSSMTP,
+}
+
+// DefaultPorts maps URL schemes, that lscerts can fetch certificates from,
+// to the port used if a URL does not give one.
+var defaultPorts = map[string]string{
+	"https": "443",
+	"smtp":  "25",
+}
+
+// StartTLSSMTP greets the SMTP server on conn then asks it to start TLS
+// returning err == nil if the server is ready for the TLS handshake.
+// If the server does not support STARTTLS, startTLSSMTP returns err != nil.
+func startTLSSMTP(conn net.Conn) (err error) {
+	const readyCode = 220
+	const okCode = 250
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(readyCode)
+	if err != nil {
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+
+	client, err := os.Hostname()
+	if err != nil {
+		client = "localhost"
+	}
+	_, err = text.Cmd("EHLO %s", client)
+	if err == nil {
+		_, _, err = text.ReadResponse(okCode)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp EHLO: %w", err)
+	}
+
+	_, err = text.Cmd("STARTTLS")
+	if err == nil {
+		_, _, err = text.ReadResponse(readyCode)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp STARTTLS: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateName is the JSON file of the serial number last seen for each URL, if not ""
+const stateNameFlag = "state"
+const stateNameText = "remember the serial number of each URL's certificate in this JSON file, " +
+	"writing which were renewed since the last run, and warn of those not renewed within -w or a month"
+
+var stateName string
+
+// SeenCert is the certificate last seen for a URL, as saved in the state file.
+type seenCert struct {
+	SerialNumber string    `json:"serialNumber"` // as written, hexadecimal if hexSerial == true
+	Expires      time.Time `json:"expires"`
+	Seen         time.Time `json:"seen"` // time of the run the certificate was seen
+}
+
+// previousCerts are the certificates seen in earlier runs by URL, read from stateName.
+var previousCerts map[string]seenCert
+
+// ReadState reads the JSON file name of the certificate last seen for each URL,
+// returning seen == the certificates by URL and err == nil.
+// If name does not exist, as on the first run, readState returns seen empty and err == nil.
+// If failed to read or decode name, readState returns seen == nil and err != nil.
+func readState(name string) (seen map[string]seenCert, err error) {
+	seen = map[string]seenCert{}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return seen, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &seen)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: %w", os.Args[0], name, err)
+	}
+	return seen, nil
+}
+
+// UpdateState compares the first of details for each URL, usually its leaf certificate,
+// with the certificate previously seen for that URL,
+// writing to standard error which were renewed, with a new serial number,
+// and a warning for those not renewed that expire within warn, or a month if warn == 0.
+// Then it writes the certificates seen, at time run, and those of URLs not in details
+// to stateName, returning err == nil.
+// If failed to write stateName, updateState returns err != nil.
+func updateState(run time.Time, details []certDetail) (err error) {
+	notRenewedTime := run.Add(warn)
+	if warn == 0 {
+		notRenewedTime = run.AddDate(0, 1, 0)
+	}
+	seen := map[string]seenCert{}
+	for url, cert := range previousCerts {
+		seen[url] = cert
+	}
+	urls := []string{} // in details, in the order they were fetched
+	for _, detail := range details {
+		if (len(urls) > 0) && (urls[len(urls)-1] == detail.URL) {
+			continue // not the first detail for the URL, such as an intermediate if chain == true
+		}
+		urls = append(urls, detail.URL)
+		seen[detail.URL] = seenCert{detail.SerialNumber, detail.Expires, run.UTC().Truncate(time.Second)}
+	}
+	for _, url := range urls {
+		previous, ok := previousCerts[url]
+		current := seen[url]
+		switch {
+		case ok == false:
+			// first seen, so cannot tell if renewed
+		case current.SerialNumber != previous.SerialNumber:
+			fmt.Fprintf(os.Stderr, "%s %q: renewed since %s, serial number %s was %s\n",
+				os.Args[0], url, formatExpires(previous.Seen), current.SerialNumber, previous.SerialNumber)
+		case current.Expires.Before(notRenewedTime):
+			fmt.Fprintf(os.Stderr, "%s %q: warning: not renewed since %s, serial number %s expires %s\n",
+				os.Args[0], url, formatExpires(previous.Seen), current.SerialNumber, formatExpires(current.Expires))
+		}
+	}
+
+	data, err := json.MarshalIndent(seen, "", "  ") // map keys are sorted, so diffs are small
+	if err != nil {
+		// cannot get here, seen only contains strings and times
+		return fmt.Errorf("%s: %w", os.Args[0], err)
+	}
+	// write a temporary file then rename it, so the state file is never partly written
+	temp, err := os.CreateTemp(filepath.Dir(stateName), filepath.Base(stateName)+".*")
+	if err == nil {
+		_, err = temp.Write(append(data, '\n'))
+		closeErr := temp.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(temp.Name(), stateName)
+		}
+		if err != nil {
+			os.Remove(temp.Name())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", os.Args[0], stateName, err)
+	}
+	return nil
+}
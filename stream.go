@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// if stream == true then write certificate details for each URL as soon as it is fetched
+const streamFlag = "stream"
+const streamText = "write certificate details for each URL as soon as it is fetched, unsorted, " +
+	"rather than sorted after fetching from all URLs"
+
+var stream bool
+
+// StreamWriter writes certificate details as they are fetched, unsorted,
+// as records by writeDetails or by executing detailTemplate if not nil.
+type streamWriter struct {
+	out        recordWriter
+	fieldsOf   func(certDetail) []string
+	withinTime time.Time // details expiring after this are not written, if within > 0
+	headed     bool      // the header has been written, before the first record
+}
+
+// NewStreamWriter returns a streamWriter of output.
+func newStreamWriter() *streamWriter {
+	w := &streamWriter{withinTime: time.Now().Add(within)}
+	w.out, w.fieldsOf = newRecordWriter()
+	return w
+}
+
+// Write writes details, the certificates of a URL just fetched, to output
+// except those that expire after within, if within > 0,
+// or are not signed with a weak algorithm, if weakOnly == true.
+// If failed to write, write will write the error to standard error then exit the program.
+func (w *streamWriter) write(details []certDetail) {
+	listed := []certDetail{}
+	for _, detail := range details {
+		if (within > 0) && detail.Expires.After(w.withinTime) {
+			continue // ignore certificate expiring after within
+		}
+		if weakOnly && (detail.weak == false) {
+			continue // ignore certificate signed with a strong algorithm
+		}
+		listed = append(listed, detail)
+	}
+	if len(listed) == 0 {
+		return
+	}
+	if detailTemplate != nil {
+		writeTemplate(listed)
+		return
+	}
+
+	if w.headed == false {
+		writeHeader(w.out)
+		w.headed = true
+	}
+	for _, detail := range listed {
+		w.out.Write(w.fieldsOf(detail))
+	}
+	w.out.Flush() // so each URL's details are seen straight away
+	err := w.out.Error()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		os.Exit(ioExit)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// if detailTemplate != nil then write each certificate detail by executing this template
+const templateFlag = "template"
+const templateText = "write each certificate's details by executing this Go text/template, " +
+	"for example '{{.URL}} {{.ToExpiry}}'"
+
+var detailTemplate *template.Template
+
+// GetTemplate parses str as a Go text/template for certificate details,
+// returning tmpl == the template and err == nil.
+// If str is "", getTemplate returns tmpl == nil and err == nil.
+// If failed to parse str, getTemplate returns tmpl == nil and err != nil.
+func getTemplate(str string) (tmpl *template.Template, err error) {
+	if str == "" {
+		return nil, nil
+	}
+	tmpl, err = template.New(templateFlag).Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", os.Args[0], err)
+	}
+	return tmpl, nil
+}
+
+// WriteTemplate writes each of details to output by executing detailTemplate, followed by a newline.
+// If failed to execute or write, writeTemplate will write the error to standard error
+// then exit the program.
+func writeTemplate(details []certDetail) {
+	out := bufio.NewWriter(output)
+	for _, detail := range details {
+		err := detailTemplate.Execute(out, detail)
+		if err == nil {
+			err = out.WriteByte('\n')
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+			os.Exit(ioExit)
+		}
+	}
+	err := out.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%s: %w", os.Args[0], err))
+		os.Exit(ioExit)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// if showVersion == true then write the version of the program then exit
+const versionFlag = "version"
+const versionText = "write the version of this program, and the Go version it was built with, then exit"
+
+var showVersion bool
+
+// Version of the program, set when building a release with
+// go build -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// GetVersion returns the version of the program: version, or the module version
+// if installed with go install, else "(devel)", followed by the Go version it was built with
+// and the commit it was built from and when that was committed, if known.
+func getVersion() (line string) {
+	line = version
+	info, ok := debug.ReadBuildInfo()
+	if (line == "") && ok {
+		line = info.Main.Version
+	}
+	if line == "" {
+		line = "(devel)"
+	}
+	line = fmt.Sprintf("lscerts %s %s", line, runtime.Version())
+	if ok == false {
+		return line
+	}
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if settings["vcs.revision"] == "" {
+		return line // not built from a repository, such as installed with go install
+	}
+	line += " commit " + settings["vcs.revision"]
+	if settings["vcs.time"] != "" {
+		line += " at " + settings["vcs.time"]
+	}
+	if settings["vcs.modified"] == "true" {
+		line += " with uncommitted changes"
+	}
+	return line
+}
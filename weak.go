@@ -0,0 +1,78 @@
+/*
+Copyright 2023 Andrew Flint arnhemcr@gmail.com
+
+This program is free software: you can redistribute it and/or modify it
+under the terms of the GNU General Public License as published by the
+Free Software Foundation, either version 3 of the License,
+or (at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY;  without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// if weakOnly == true then only write details of certificates signed with a weak algorithm
+const weakOnlyFlag = "weak-only"
+const weakOnlyText = "only write details of certificates signed with a weak algorithm, " +
+	"such as SHA-1 or MD5, for finding the certificates to replace"
+
+var weakOnly bool
+
+// WeakSignatureAlgs are the signature algorithms, using MD2, MD5 or SHA-1,
+// that can be forged so are no longer trusted by browsers.
+var weakSignatureAlgs = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// WeakMark follows the signature algorithm of a certificate signed with a weak algorithm.
+const weakMark = "WEAK"
+
+// IsWeakSigned reports whether cert is signed with a weak algorithm,
+// other than a root that is self-signed, whose signature is not checked as it is trusted itself.
+func isWeakSigned(cert *x509.Certificate) bool {
+	return weakSignatureAlgs[cert.SignatureAlgorithm] && (isSelfSigned(cert) == false)
+}
+
+// GetSignatureAlg returns the algorithm cert is signed with, such as SHA256-RSA,
+// followed by weakMark if it is weak.
+func getSignatureAlg(cert *x509.Certificate) (alg string) {
+	alg = cert.SignatureAlgorithm.String()
+	if isWeakSigned(cert) {
+		alg += " " + weakMark
+	}
+	return alg
+}
+
+// WarnWeakSignatures writes a warning to standard error for each certificate in state,
+// fetched from hostPort, that is signed with a weak algorithm.
+// Certificates are taken from the first verified chain, or as fetched if not verified,
+// as a chain with a weak signature only validates if insecure == true.
+func warnWeakSignatures(hostPort string, state tls.ConnectionState) {
+	certs := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		certs = state.VerifiedChains[0]
+	}
+	for _, cert := range certs {
+		if isWeakSigned(cert) {
+			fmt.Fprintf(os.Stderr, "%s %q: warning: %q is signed with weak algorithm %s\n",
+				os.Args[0], hostPort, cert.Subject.CommonName, cert.SignatureAlgorithm)
+		}
+	}
+}